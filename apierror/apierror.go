@@ -0,0 +1,116 @@
+// Package apierror writes error responses as RFC 7807 problem details
+// (application/problem+json). Every problem carries a stable code that
+// clients can match on and the ID of the request. Errors that aren't meant
+// for clients are logged and replaced with a generic 500 response.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"blog2/requestid"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// Codes shared by many endpoints. Endpoints use more specific codes, such
+// as "post_not_found", where clients may want to tell cases apart.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidBody      = "invalid_body"
+	CodeUnknownField     = "unknown_field"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeUpstream         = "upstream_error"
+)
+
+// Problem is the body of an error response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"` // Path of the request
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error whose details are safe to show to clients
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Fields []FieldError
+}
+
+// New returns an error to show to clients
+func New(status int, code string, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Error returns the detail message
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// WithFields returns a copy of e listing problems with individual fields
+func (e *Error) WithFields(fields []FieldError) *Error {
+	copied := *e
+	copied.Fields = fields
+	return &copied
+}
+
+// Write writes err as a problem response. An *Error anywhere in the chain of
+// err is shown as is. Any other error is logged with the request ID and
+// answered with a generic 500, so internal details never reach clients.
+// Errors caused by the client going away, which cancels the request's
+// queries, are only logged at info level.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	requestID := requestid.FromContext(r.Context())
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		if r.Context().Err() != nil {
+			slog.InfoContext(r.Context(), "Request cancelled", "method", r.Method, "path", r.URL.Path, "err", err)
+		} else {
+			slog.ErrorContext(r.Context(), "Internal error", "method", r.Method, "path", r.URL.Path, "err", err)
+		}
+		apiErr = New(http.StatusInternalServerError, CodeInternal, "An internal error occurred")
+	}
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Code:      apiErr.Code,
+		Detail:    apiErr.Detail,
+		Instance:  r.URL.Path,
+		RequestID: requestID,
+		Errors:    apiErr.Fields,
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"blog2/models"
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+)
+
+// Scopes that can be granted to API keys. Session tokens have every scope,
+// including ScopeAccount, which API keys can never be granted.
+const (
+	ScopePostsRead   = "posts:read"
+	ScopePostsWrite  = "posts:write"
+	ScopeProfileRead = "profile:read"
+	ScopeAccount     = "account"
+)
+
+// apiKeyPrefix starts every API key, making leaked keys easy to recognise
+const apiKeyPrefix = "blog_"
+
+// CredentialStore looks up credentials that are stored server-side
+type CredentialStore interface {
+	// AuthenticateAPIKey returns the claims for a valid API key, or
+	// ErrInvalidAPIKey if the key is unknown, revoked or expired
+	AuthenticateAPIKey(ctx context.Context, key string) (models.TokenClaims, error)
+
+	// TouchSession records activity on a session, or returns
+	// ErrRevokedSession if it has been revoked or has expired
+	TouchSession(ctx context.Context, sessionID string, userID int) error
+}
+
+// GenerateAPIKey returns a new API key and its lookup prefix. Keys have the
+// form blog_<prefix>_<secret>.
+func GenerateAPIKey() (string, string, error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	prefix := hex.EncodeToString(prefixBytes)
+	key := apiKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	return key, prefix, nil
+}
+
+// ParseAPIKeyPrefix extracts the lookup prefix from an API key
+func ParseAPIKeyPrefix(key string) (string, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", ErrInvalidAPIKey
+	}
+
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", ErrInvalidAPIKey
+	}
+
+	return prefix, nil
+}
+
+// HasScope reports whether the claims grant the given scope
+func HasScope(claims models.TokenClaims, scope string) bool {
+	if claims.Scopes == nil {
+		return true
+	}
+
+	for _, s := range claims.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
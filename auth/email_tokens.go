@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"blog2/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token purposes for signed links. A session token has no purpose claim, so
+// a purpose token can never be used as a bearer token and vice versa.
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeEmailChange       = "email_change"
+)
+
+// EmailTokenClaims represents the claims in a signed email link
+type EmailTokenClaims struct {
+	UserID  int
+	Email   string
+	Purpose string
+
+	// For PurposeEmailChange, the address and password stamp the user had
+	// when the change was requested
+	PreviousEmail string
+	PasswordStamp string
+}
+
+// GenerateEmailToken creates a signed token proving ownership of email by the
+// given user. For PurposeEmailVerification the email is the user's current
+// address, so the token stops working if it changes before the link is
+// followed. For PurposeEmailChange it is the new address to switch to, and
+// the token also records the user's current address and password so that
+// the change can be refused if either has changed since.
+func GenerateEmailToken(user models.User, email string, purpose string, ttl time.Duration, config JWTConfig) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"email":   email,
+		"purpose": purpose,
+		"exp":     time.Now().Add(ttl).Unix(),
+	}
+
+	if purpose == PurposeEmailChange {
+		claims["previous_email"] = user.Email
+		claims["password_stamp"] = PasswordStamp(user.PasswordHash)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.SecretKey))
+}
+
+// ValidateEmailToken checks a signed email token and returns its claims
+func ValidateEmailToken(tokenString string, config JWTConfig) (EmailTokenClaims, error) {
+	claims, err := parseClaims(tokenString, config)
+	if err != nil {
+		return EmailTokenClaims{}, err
+	}
+
+	purpose, _ := claims["purpose"].(string)
+	if purpose != PurposeEmailVerification && purpose != PurposeEmailChange {
+		return EmailTokenClaims{}, ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return EmailTokenClaims{}, ErrInvalidToken
+	}
+
+	email, ok := claims["email"].(string)
+	if !ok {
+		return EmailTokenClaims{}, ErrInvalidToken
+	}
+
+	result := EmailTokenClaims{
+		UserID:  int(userID),
+		Email:   email,
+		Purpose: purpose,
+	}
+
+	if purpose == PurposeEmailChange {
+		result.PreviousEmail, _ = claims["previous_email"].(string)
+		result.PasswordStamp, _ = claims["password_stamp"].(string)
+		if result.PreviousEmail == "" || result.PasswordStamp == "" {
+			return EmailTokenClaims{}, ErrInvalidToken
+		}
+	}
+
+	return result, nil
+}
+
+// PasswordStamp returns a short fingerprint of a password hash. Tokens that
+// carry it can be refused once the password changes, without revealing the
+// hash itself.
+func PasswordStamp(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:12])
+}
+
+// parseClaims verifies the signature and expiry of a token and returns its claims
+func parseClaims(tokenString string, config JWTConfig) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(config.SecretKey), nil
+	})
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
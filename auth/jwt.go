@@ -2,7 +2,6 @@ package auth
 
 import (
 	"errors"
-	"fmt"
 	"time"
 
 	"blog2/models"
@@ -10,8 +9,9 @@ import (
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token has expired")
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrExpiredToken   = errors.New("token has expired")
+	ErrRevokedSession = errors.New("session has been revoked")
 )
 
 // JWTConfig holds configuration for JWT tokens
@@ -20,20 +20,25 @@ type JWTConfig struct {
 	TokenDuration time.Duration
 }
 
+// PlaceholderSecretKey is the signing secret of DefaultJWTConfig. It is
+// public, so the server refuses to use it outside dev mode.
+const PlaceholderSecretKey = "your-secret-key-change-in-production"
+
 // DefaultJWTConfig returns a default JWT configuration
 func DefaultJWTConfig() JWTConfig {
 	return JWTConfig{
-		SecretKey:     "your-secret-key-change-in-production", // Should be set from environment variable in production
-		TokenDuration: 24 * time.Hour,                         // 24 hours
+		SecretKey:     PlaceholderSecretKey, // Must be replaced through configuration in production
+		TokenDuration: 24 * time.Hour,       // 24 hours
 	}
 }
 
-// GenerateToken creates a new JWT token for a user
-func GenerateToken(user models.User, config JWTConfig) (string, error) {
+// GenerateToken creates a new JWT token for a user, bound to a session
+func GenerateToken(user models.User, sessionID string, config JWTConfig) (string, error) {
 	// Create the claims
 	claims := jwt.MapClaims{
 		"user_id":  user.ID,
 		"username": user.Username,
+		"sid":      sessionID,
 		"exp":      time.Now().Add(config.TokenDuration).Unix(),
 	}
 
@@ -51,30 +56,13 @@ func GenerateToken(user models.User, config JWTConfig) (string, error) {
 
 // ValidateToken checks if a token is valid and returns the claims
 func ValidateToken(tokenString string, config JWTConfig) (models.TokenClaims, error) {
-	// Parse the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(config.SecretKey), nil
-	})
-
+	claims, err := parseClaims(tokenString, config)
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return models.TokenClaims{}, ErrExpiredToken
-		}
-		return models.TokenClaims{}, ErrInvalidToken
-	}
-
-	// Check if the token is valid
-	if !token.Valid {
-		return models.TokenClaims{}, ErrInvalidToken
+		return models.TokenClaims{}, err
 	}
 
-	// Extract the claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	// Reject tokens issued for signed links rather than sessions
+	if _, ok := claims["purpose"]; ok {
 		return models.TokenClaims{}, ErrInvalidToken
 	}
 
@@ -89,8 +77,14 @@ func ValidateToken(tokenString string, config JWTConfig) (models.TokenClaims, er
 		return models.TokenClaims{}, ErrInvalidToken
 	}
 
+	sessionID, ok := claims["sid"].(string)
+	if !ok || sessionID == "" {
+		return models.TokenClaims{}, ErrInvalidToken
+	}
+
 	return models.TokenClaims{
-		UserID:   int(userID),
-		Username: username,
+		UserID:    int(userID),
+		Username:  username,
+		SessionID: sessionID,
 	}, nil
 }
@@ -2,10 +2,15 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"blog2/apierror"
+	"blog2/logging"
 	"blog2/models"
+	"go.opentelemetry.io/otel"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
@@ -16,38 +21,24 @@ const (
 	UserClaimsKey contextKey = "user_claims"
 )
 
-// AuthMiddleware creates middleware for authenticating requests
-func AuthMiddleware(config JWTConfig) func(http.Handler) http.Handler {
+var (
+	errMissingAuthorization = errors.New("authorization header required")
+	errInvalidAuthorization = errors.New("invalid authorization format")
+)
+
+// AuthMiddleware creates middleware for authenticating requests with either a
+// Bearer token or an API key
+func AuthMiddleware(config JWTConfig, store CredentialStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get the Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
-				return
-			}
-
-			// Check if it's a Bearer token
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				http.Error(w, "Invalid authorization format, Bearer token required", http.StatusUnauthorized)
-				return
-			}
-
-			// Extract the token
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-			// Validate the token
-			claims, err := ValidateToken(tokenString, config)
+			claims, err := authenticate(r, config, store)
 			if err != nil {
-				if err == ErrExpiredToken {
-					http.Error(w, "Token has expired", http.StatusUnauthorized)
-				} else {
-					http.Error(w, "Invalid token", http.StatusUnauthorized)
-				}
+				apierror.Write(w, r, authError(err))
 				return
 			}
 
-			// Add the claims to the request context
+			// Add the claims to the request context, and the user to its logs
+			logging.SetUser(r.Context(), claims.UserID)
 			ctx := context.WithValue(r.Context(), UserClaimsKey, claims)
 
 			// Call the next handler with the updated context
@@ -56,6 +47,65 @@ func AuthMiddleware(config JWTConfig) func(http.Handler) http.Handler {
 	}
 }
 
+// authError returns the response for a failed authentication. Unexpected
+// errors are passed through, to be logged and answered with a 500.
+func authError(err error) error {
+	unauthorized := func(code string, detail string) error {
+		return apierror.New(http.StatusUnauthorized, code, detail)
+	}
+
+	switch {
+	case errors.Is(err, errMissingAuthorization):
+		return unauthorized("missing_authorization", "Authorization header required")
+	case errors.Is(err, errInvalidAuthorization):
+		return unauthorized("invalid_authorization", "Invalid authorization format, Bearer token or ApiKey required")
+	case errors.Is(err, ErrExpiredToken):
+		return unauthorized("token_expired", "Token has expired")
+	case errors.Is(err, ErrInvalidToken):
+		return unauthorized("invalid_token", "Invalid token")
+	case errors.Is(err, ErrRevokedSession):
+		return unauthorized("session_revoked", "Session has been revoked")
+	case errors.Is(err, ErrInvalidAPIKey):
+		return unauthorized("invalid_api_key", "Invalid API key")
+	default:
+		return fmt.Errorf("authenticating request: %w", err)
+	}
+}
+
+// tracer creates the spans of request authentication
+var tracer = otel.Tracer("blog2/auth")
+
+// authenticate checks the credentials in the Authorization header
+func authenticate(r *http.Request, config JWTConfig, store CredentialStore) (models.TokenClaims, error) {
+	ctx, span := tracer.Start(r.Context(), "auth.authenticate")
+	defer span.End()
+
+	// Get the Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return models.TokenClaims{}, errMissingAuthorization
+	}
+
+	switch {
+	case strings.HasPrefix(authHeader, "Bearer "):
+		claims, err := ValidateToken(strings.TrimPrefix(authHeader, "Bearer "), config)
+		if err != nil {
+			return models.TokenClaims{}, err
+		}
+
+		// The token is only good while its session has not been revoked
+		if err := store.TouchSession(ctx, claims.SessionID, claims.UserID); err != nil {
+			return models.TokenClaims{}, err
+		}
+
+		return claims, nil
+	case strings.HasPrefix(authHeader, "ApiKey "):
+		return store.AuthenticateAPIKey(ctx, strings.TrimPrefix(authHeader, "ApiKey "))
+	default:
+		return models.TokenClaims{}, errInvalidAuthorization
+	}
+}
+
 // GetUserClaims extracts user claims from the request context
 func GetUserClaims(r *http.Request) (models.TokenClaims, bool) {
 	claims, ok := r.Context().Value(UserClaimsKey).(models.TokenClaims)
@@ -63,36 +113,18 @@ func GetUserClaims(r *http.Request) (models.TokenClaims, bool) {
 }
 
 // RequireAuth is a middleware that requires authentication for specific routes
-func RequireAuth(config JWTConfig) func(http.Handler) http.Handler {
-	return AuthMiddleware(config)
+func RequireAuth(config JWTConfig, store CredentialStore) func(http.Handler) http.Handler {
+	return AuthMiddleware(config, store)
 }
 
-// OptionalAuth is middleware that adds user claims to context if token is present, but doesn't require it
-func OptionalAuth(config JWTConfig) func(http.Handler) http.Handler {
+// OptionalAuth is middleware that adds user claims to context if valid credentials are present, but doesn't require them
+func OptionalAuth(config JWTConfig, store CredentialStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get the Authorization header
-			authHeader := r.Header.Get("Authorization")
-
-			// If no Authorization header, just continue
-			if authHeader == "" {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			// Check if it's a Bearer token
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			// Extract the token
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-			// Validate the token
-			claims, err := ValidateToken(tokenString, config)
+			claims, err := authenticate(r, config, store)
 			if err == nil {
-				// Add the claims to the request context
+				// Add the claims to the request context, and the user to its logs
+				logging.SetUser(r.Context(), claims.UserID)
 				ctx := context.WithValue(r.Context(), UserClaimsKey, claims)
 				r = r.WithContext(ctx)
 			}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PurposeOIDCFlow marks a token carrying the state of an OpenID Connect login
+const PurposeOIDCFlow = "oidc_flow"
+
+// OIDCFlowClaims holds what the callback needs to finish an OpenID Connect
+// login started by the same browser
+type OIDCFlowClaims struct {
+	Provider     string
+	State        string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   int // Set when an existing user is linking a new identity
+}
+
+// GenerateOIDCFlowToken signs the flow state so it can be kept in a cookie
+func GenerateOIDCFlowToken(flow OIDCFlowClaims, ttl time.Duration, config JWTConfig) (string, error) {
+	claims := jwt.MapClaims{
+		"provider":      flow.Provider,
+		"state":         flow.State,
+		"nonce":         flow.Nonce,
+		"code_verifier": flow.CodeVerifier,
+		"link_user_id":  flow.LinkUserID,
+		"purpose":       PurposeOIDCFlow,
+		"exp":           time.Now().Add(ttl).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.SecretKey))
+}
+
+// ValidateOIDCFlowToken checks a flow token and returns its claims
+func ValidateOIDCFlowToken(tokenString string, config JWTConfig) (OIDCFlowClaims, error) {
+	claims, err := parseClaims(tokenString, config)
+	if err != nil {
+		return OIDCFlowClaims{}, err
+	}
+
+	if purpose, _ := claims["purpose"].(string); purpose != PurposeOIDCFlow {
+		return OIDCFlowClaims{}, ErrInvalidToken
+	}
+
+	var flow OIDCFlowClaims
+	var ok bool
+	if flow.Provider, ok = claims["provider"].(string); !ok {
+		return OIDCFlowClaims{}, ErrInvalidToken
+	}
+	if flow.State, ok = claims["state"].(string); !ok {
+		return OIDCFlowClaims{}, ErrInvalidToken
+	}
+	if flow.Nonce, ok = claims["nonce"].(string); !ok {
+		return OIDCFlowClaims{}, ErrInvalidToken
+	}
+	if flow.CodeVerifier, ok = claims["code_verifier"].(string); !ok {
+		return OIDCFlowClaims{}, ErrInvalidToken
+	}
+
+	linkUserID, ok := claims["link_user_id"].(float64)
+	if !ok {
+		return OIDCFlowClaims{}, ErrInvalidToken
+	}
+	flow.LinkUserID = int(linkUserID)
+
+	return flow, nil
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// The RFC lists eight-digit codes; six-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		step := tt.unix / 30
+
+		if got := totpCode(key, step); got != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+
+		gotStep, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok || gotStep != step {
+			t.Errorf("ValidateTOTP(%s) at %d = %d, %v; want %d, true", tt.code, tt.unix, gotStep, ok, step)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / 30
+
+	tests := []struct {
+		offset int64
+		valid  bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+
+	for _, tt := range tests {
+		code := totpCode(key, current+tt.offset)
+
+		step, ok := ValidateTOTP(rfc6238Secret, code, now)
+		if ok != tt.valid {
+			t.Errorf("code from step %+d: valid = %v, want %v", tt.offset, ok, tt.valid)
+		}
+		if ok && step != current+tt.offset {
+			t.Errorf("code from step %+d: step = %d, want %d", tt.offset, step, current+tt.offset)
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		valid  bool
+	}{
+		{"spaces", rfc6238Secret, "050 471", true},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), "050471", true},
+		{"wrong code", rfc6238Secret, "050472", false},
+		{"too short", rfc6238Secret, "50471", false},
+		{"too long", rfc6238Secret, "0050471", false},
+		{"invalid secret", "not base32!", "050471", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok != tt.valid {
+			t.Errorf("%s: valid = %v, want %v", tt.name, ok, tt.valid)
+		}
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"abcde-fghij", "abcde-fghij"},
+		{"ABCDE-FGHIJ", "abcde-fghij"},
+		{"abcdefghij", "abcde-fghij"},
+		{" abcde fghij ", "abcde-fghij"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.input); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
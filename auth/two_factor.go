@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PurposeTwoFactorPending marks a token issued after a correct password for an
+// account with two-factor authentication, before the second factor is checked
+const PurposeTwoFactorPending = "two_factor_pending"
+
+// recoveryCodeAlphabet avoids characters that are easily confused
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateTwoFactorPendingToken creates a short-lived token that can only be
+// exchanged for a session token together with a valid second factor
+func GenerateTwoFactorPendingToken(userID int, ttl time.Duration, config JWTConfig) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": PurposeTwoFactorPending,
+		"exp":     time.Now().Add(ttl).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.SecretKey))
+}
+
+// ValidateTwoFactorPendingToken checks a pending token and returns its user ID
+func ValidateTwoFactorPendingToken(tokenString string, config JWTConfig) (int, error) {
+	claims, err := parseClaims(tokenString, config)
+	if err != nil {
+		return 0, err
+	}
+
+	if purpose, _ := claims["purpose"].(string); purpose != PurposeTwoFactorPending {
+		return 0, ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+
+	return int(userID), nil
+}
+
+// GenerateRecoveryCodes returns n one-time recovery codes of the form xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		var code strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+
+			k, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, err
+			}
+			code.WriteByte(recoveryCodeAlphabet[k.Int64()])
+		}
+		codes[i] = code.String()
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode puts a recovery code typed by a user into the form it
+// was generated in, so that it hashes to the stored value
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) == 10 && !strings.Contains(code, "-") {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"blog2/handlers"
+)
+
+// runCheck reports schema and data problems, exiting with an error if any
+// remain
+func runCheck(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "recompute reaction counters that don't match the reactions")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	problems := 0
+
+	if err := a.migrator.Verify(ctx); err != nil {
+		fmt.Fprintf(a.out, "schema: %v\n", err)
+		problems++
+	}
+
+	version, err := a.migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version != a.migrator.Latest() {
+		fmt.Fprintf(a.out, "schema: database is at version %d, the latest migration is %d\n", version, a.migrator.Latest())
+		problems++
+	}
+
+	if *fix {
+		fixed, err := a.db.RecountReactions(ctx)
+		if err != nil {
+			return err
+		}
+		if fixed > 0 {
+			fmt.Fprintf(a.out, "Recounted reactions of %d posts\n", fixed)
+		}
+	}
+
+	issues, err := a.db.CheckIntegrity(ctx, handlers.AnonymousAuthor)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(a.out, "%s: %s\n", issue.Check, issue.Detail)
+	}
+	problems += len(issues)
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problems", problems)
+	}
+
+	fmt.Fprintln(a.out, "No problems found")
+	return nil
+}
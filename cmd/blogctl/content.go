@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"blog2/models"
+)
+
+// runExport writes every post as a models.PostsExport
+func runExport(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "", "file to write instead of stdout")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	posts, err := a.db.GetPosts(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = a.out
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(models.PostsExport{ExportedAt: time.Now().UTC(), Posts: posts}); err != nil {
+		return err
+	}
+
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d posts to %s\n", len(posts), *output)
+	}
+	return nil
+}
+
+// runImport adds the posts of a models.PostsExport file
+func runImport(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var export models.PostsExport
+	if err := json.NewDecoder(f).Decode(&export); err != nil {
+		return fmt.Errorf("reading %s: %w", args[0], err)
+	}
+
+	imported, skipped := 0, 0
+	for i, p := range export.Posts {
+		if p.Title == "" || p.Content == "" || p.CreatedBy == "" || p.DateCreated.IsZero() {
+			return fmt.Errorf("post %d in %s is missing its title, content, author or creation date", i+1, args[0])
+		}
+
+		ok, err := a.db.ImportPost(ctx, p)
+		if err != nil {
+			return fmt.Errorf("importing post %d: %w", i+1, err)
+		}
+		if ok {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+
+	fmt.Fprintf(a.out, "Imported %d posts, skipped %d already present\n", imported, skipped)
+	return nil
+}
@@ -0,0 +1,197 @@
+// Command blogctl runs operational tasks against the blog database. It reads
+// the same configuration file, environment variables and flags as the
+// server, given before the command:
+//
+//	blogctl -config config.yaml migrate status
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"blog2/config"
+	"blog2/db"
+	"blog2/migrate"
+	"blog2/migrations"
+	"blog2/password"
+)
+
+// command is a blogctl command
+type command struct {
+	usage string // Arguments, shown after the command name
+	help  string
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+// commands lists every command by name
+var commands = map[string]command{
+	"migrate": {
+		usage: "up | down [-steps N] | status",
+		help:  "apply, revert or list database migrations",
+		run:   runMigrate,
+	},
+	"user": {
+		usage: "create -username NAME -email EMAIL [-role ROLE] [-verified] | promote [-role ROLE] USERNAME",
+		help:  "create a user, or change a user's role (admin by default); the password is read from stdin",
+		run:   runUser,
+	},
+	"reset-password": {
+		usage: "USERNAME",
+		help:  "set a new password read from stdin and log the user out everywhere",
+		run:   runResetPassword,
+	},
+	"tokens": {
+		usage: "list USERNAME | revoke [-session ID] [-api-key ID] [-all] USERNAME",
+		help:  "list or revoke a user's sessions and API keys",
+		run:   runTokens,
+	},
+	"export": {
+		usage: "[-o FILE]",
+		help:  "write every post as JSON to FILE or stdout",
+		run:   runExport,
+	},
+	"import": {
+		usage: "FILE",
+		help:  "add the posts in a file written by export, skipping ones already imported",
+		run:   runImport,
+	},
+	"check": {
+		usage: "[-fix]",
+		help:  "check the schema version and data integrity, optionally repairing reaction counters",
+		run:   runCheck,
+	},
+}
+
+// errUsage is returned by commands given the wrong arguments
+var errUsage = errors.New("invalid arguments")
+
+// app holds what commands need to run
+type app struct {
+	cfg      config.Config
+	db       *db.DB
+	migrator *migrate.Migrator
+	in       *bufio.Reader
+	out      io.Writer
+}
+
+func main() {
+	fs := flag.NewFlagSet("blogctl", flag.ExitOnError)
+	fs.Usage = func() { usage(fs) }
+	loader := config.NewLoader(fs)
+	fs.Parse(os.Args[1:])
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		usage(fs)
+		os.Exit(2)
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer a.db.Close()
+
+	// Interrupting blogctl cancels the query it is running
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = cmd.run(ctx, a, fs.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "usage: blogctl %s %s\n", fs.Arg(0), cmd.usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		a.db.Close()
+		fatalf("%s: %v", fs.Arg(0), err)
+	}
+}
+
+// newApp connects to the database described by cfg
+func newApp(cfg config.Config) (*app, error) {
+	// Admin tasks such as export and check may run long, so they aren't
+	// limited like requests are; interrupting blogctl cancels them instead
+	dbConfig := cfg.Database.DBConfig()
+	dbConfig.QueryTimeout = 0
+
+	database, err := db.NewDB(dbConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	database.Hasher, err = password.NewHasher(cfg.Password.HashConfig())
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	migrator, err := migrate.New(database.DB, migrations.FS)
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return &app{
+		cfg:      cfg,
+		db:       database,
+		migrator: migrator,
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stdout,
+	}, nil
+}
+
+// readPassword reads a password from the first line of stdin, prompting
+// for it on stderr
+func (a *app) readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := a.in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+
+	pw := strings.TrimRight(line, "\r\n")
+	if pw == "" {
+		return "", errors.New("password is empty")
+	}
+
+	return pw, nil
+}
+
+// usage prints the commands and configuration flags
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintln(w, "usage: blogctl [config flags] COMMAND [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s %s\n    \t%s\n", name, commands[name].usage, commands[name].help)
+	}
+
+	fmt.Fprintln(w, "\nConfig flags:")
+	fs.PrintDefaults()
+}
+
+// fatalf prints an error and exits
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "blogctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+)
+
+// runTokens lists and revokes sessions and API keys
+func runTokens(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return listTokens(ctx, a, args[1:])
+	case "revoke":
+		return revokeTokens(ctx, a, args[1:])
+	}
+
+	return errUsage
+}
+
+// listTokens prints a user's active sessions and API keys
+func listTokens(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	user, err := a.db.GetUserByUsername(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	sessions, err := a.db.GetSessionsByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	keys, err := a.db.GetAPIKeysByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	const timeFormat = "2006-01-02 15:04"
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tID\tDESCRIPTION\tCREATED\tLAST USED\tEXPIRES")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "session\t%s\t%s %s\t%s\t%s\t%s\n", s.ID, s.IP, s.UserAgent,
+			s.DateCreated.Local().Format(timeFormat), s.LastSeenAt.Local().Format(timeFormat),
+			s.ExpiresAt.Local().Format(timeFormat))
+	}
+	for _, k := range keys {
+		lastUsed, expires := "never", "never"
+		if k.LastUsedAt != nil {
+			lastUsed = k.LastUsedAt.Local().Format(timeFormat)
+		}
+		if k.ExpiresAt != nil {
+			expires = k.ExpiresAt.Local().Format(timeFormat)
+		}
+		fmt.Fprintf(w, "api-key\t%d\t%s (%s) %v\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Scopes,
+			k.DateCreated.Local().Format(timeFormat), lastUsed, expires)
+	}
+
+	return w.Flush()
+}
+
+// revokeTokens revokes one session, one API key or everything of a user
+func revokeTokens(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("tokens revoke", flag.ContinueOnError)
+	sessionID := fs.String("session", "", "ID of the session to revoke")
+	keyID := fs.Int("api-key", 0, "ID of the API key to revoke")
+	all := fs.Bool("all", false, "revoke every session and API key")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	chosen := 0
+	for _, set := range []bool{*sessionID != "", *keyID != 0, *all} {
+		if set {
+			chosen++
+		}
+	}
+	if chosen != 1 {
+		return errUsage
+	}
+
+	user, err := a.db.GetUserByUsername(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *sessionID != "":
+		if err := a.db.RevokeSession(ctx, user.ID, *sessionID); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Revoked session %s\n", *sessionID)
+
+	case *keyID != 0:
+		if err := a.db.RevokeAPIKey(ctx, user.ID, *keyID); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Revoked API key %d\n", *keyID)
+
+	default:
+		if err := a.db.RevokeOtherSessions(ctx, user.ID, ""); err != nil {
+			return err
+		}
+		revoked, err := a.db.RevokeAllAPIKeys(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Revoked every session and %d API keys of %s\n", revoked, user.Username)
+	}
+
+	return nil
+}
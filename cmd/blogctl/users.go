@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"blog2/models"
+	"blog2/password"
+)
+
+// runUser creates users and changes their role
+func runUser(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "create":
+		return createUser(ctx, a, args[1:])
+	case "promote":
+		return promoteUser(ctx, a, args[1:])
+	}
+
+	return errUsage
+}
+
+// createUser registers a user with a password read from stdin
+func createUser(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	username := fs.String("username", "", "username of the new user")
+	email := fs.String("email", "", "email address of the new user")
+	role := fs.String("role", models.RoleUser, "role of the new user, user or admin")
+	verified := fs.Bool("verified", false, "mark the email address as verified")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *username == "" || *email == "" {
+		return errUsage
+	}
+
+	if !models.IsValidUsername(*username) {
+		return fmt.Errorf("username %q is reserved or uses characters other than letters, digits, '_', '.' and '-'", *username)
+	}
+	if !models.IsRole(*role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	pw, err := a.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := a.checkPasswordPolicy(password.Candidate{Password: pw, Username: *username, Email: *email}); err != nil {
+		return err
+	}
+
+	user, err := a.db.CreateUser(ctx, models.NewUser{Username: *username, Email: *email, Password: pw})
+	if err != nil {
+		return err
+	}
+
+	if *verified {
+		if user, err = a.db.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+			return err
+		}
+	}
+
+	if *role != models.RoleUser {
+		if user, err = a.db.SetRole(ctx, user.ID, *role); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(a.out, "Created %s %s (id %d)\n", user.Role, user.Username, user.ID)
+	return nil
+}
+
+// promoteUser changes the role of a user
+func promoteUser(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("user promote", flag.ContinueOnError)
+	role := fs.String("role", models.RoleAdmin, "new role, user or admin")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	if !models.IsRole(*role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	user, err := a.db.GetUserByUsername(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	user, err = a.db.SetRole(ctx, user.ID, *role)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.out, "%s is now %s\n", user.Username, user.Role)
+	return nil
+}
+
+// runResetPassword sets a user's password and revokes their sessions
+func runResetPassword(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	user, err := a.db.GetUserByUsername(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	pw, err := a.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := a.checkPasswordPolicy(password.Candidate{Password: pw, Username: user.Username, Email: user.Email}); err != nil {
+		return err
+	}
+
+	if err := a.db.SetPassword(ctx, user.ID, pw); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.out, "Password of %s changed and all sessions revoked\n", user.Username)
+	return nil
+}
+
+// checkPasswordPolicy applies the configured password policy, returning an
+// error that lists every rule the password breaks
+func (a *app) checkPasswordPolicy(candidate password.Candidate) error {
+	policy, err := password.NewPolicy(a.cfg.Password.PolicyConfig())
+	if err != nil {
+		return err
+	}
+
+	violations, err := policy.Validate(candidate)
+	if err != nil {
+		return err
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = v.Message
+	}
+
+	return errors.New("password rejected: " + strings.Join(messages, "; "))
+}
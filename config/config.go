@@ -0,0 +1,350 @@
+// Package config loads the server configuration from defaults, a YAML file,
+// environment variables and command-line flags, in that order of
+// precedence.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/logging"
+	"blog2/password"
+	"blog2/tracing"
+)
+
+// Modes the server can run in
+const (
+	ModeDev        = "dev"
+	ModeProduction = "production"
+)
+
+// minSecretLength is the shortest JWT secret accepted outside dev mode
+const minSecretLength = 32
+
+// Config holds every setting of the server
+type Config struct {
+	Mode     string         `yaml:"mode"` // ModeDev relaxes checks meant for production
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Health   HealthConfig   `yaml:"health"`
+	Database DatabaseConfig `yaml:"database"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Mail     MailConfig     `yaml:"mail"`
+	Posts    PostsConfig    `yaml:"posts"`
+	Account  AccountConfig  `yaml:"account"`
+	Password PasswordConfig `yaml:"password"`
+	Site     SiteConfig     `yaml:"site"`
+	OIDC     OIDCConfig     `yaml:"oidc"`
+}
+
+// ServerConfig holds settings for the HTTP server
+type ServerConfig struct {
+	Addr            string        `yaml:"addr"`       // Address to listen on
+	PublicURL       string        `yaml:"public_url"` // Base URL clients reach the server at
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	DrainDelay      time.Duration `yaml:"drain_delay"` // How long /readyz fails before the server stops accepting connections
+}
+
+// LogConfig holds settings for the server log
+type LogConfig struct {
+	Level  string `yaml:"level"`  // "debug", "info", "warn" or "error"
+	Format string `yaml:"format"` // "json" or "text"
+}
+
+// MetricsConfig holds settings for the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"` // Serve /metrics
+	Token   string `yaml:"token"`   // Bearer token scrapers must send; open if empty
+}
+
+// TracingConfig holds settings for OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter"`     // "none", "otlp" or "stdout"
+	Endpoint    string `yaml:"endpoint"`     // OTLP/HTTP collector URL, such as http://localhost:4318
+	ServiceName string `yaml:"service_name"` // Name the server's spans are reported under
+}
+
+// HealthConfig holds settings for the health endpoints
+type HealthConfig struct {
+	ReadyTimeout time.Duration `yaml:"ready_timeout"` // How long the database gets to answer /readyz
+}
+
+// DatabaseConfig holds settings for the database connection
+type DatabaseConfig struct {
+	URL             string        `yaml:"url"`          // PostgreSQL connection string
+	AutoMigrate     bool          `yaml:"auto_migrate"` // Apply pending migrations at startup
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	QueryTimeout    time.Duration `yaml:"query_timeout"` // Longest a database call may take; 0 is no limit
+}
+
+// DBConfig returns the settings for db.NewDB
+func (c DatabaseConfig) DBConfig() db.Config {
+	return db.Config{
+		URL:             c.URL,
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: c.ConnMaxLifetime,
+		ConnMaxIdleTime: c.ConnMaxIdleTime,
+		QueryTimeout:    c.QueryTimeout,
+	}
+}
+
+// JWTConfig holds settings for signing tokens
+type JWTConfig struct {
+	Secret        string        `yaml:"secret"`
+	TokenDuration time.Duration `yaml:"token_duration"`
+}
+
+// MailConfig holds settings for outgoing mail
+type MailConfig struct {
+	SMTPHost     string `yaml:"smtp_host"` // Mail is written to OutboxFile when empty
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	From         string `yaml:"from"`
+	OutboxFile   string `yaml:"outbox_file"`
+}
+
+// PostsConfig holds settings for publishing posts
+type PostsConfig struct {
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+}
+
+// AccountConfig holds settings for account management flows
+type AccountConfig struct {
+	PasswordResetTTL           time.Duration `yaml:"password_reset_ttl"`
+	VerificationTTL            time.Duration `yaml:"verification_ttl"`
+	VerificationResendInterval time.Duration `yaml:"verification_resend_interval"`
+	DeletedPostsPolicy         string        `yaml:"deleted_posts_policy"` // "anonymize" or "reassign"
+	PostsReassignTo            string        `yaml:"posts_reassign_to"`
+	TwoFactorIssuer            string        `yaml:"two_factor_issuer"`
+}
+
+// PasswordConfig holds settings for password hashing and policy
+type PasswordConfig struct {
+	HashAlgorithm       string `yaml:"hash_algorithm"` // "argon2id" or "bcrypt"
+	BcryptCost          int    `yaml:"bcrypt_cost"`
+	MinLength           int    `yaml:"min_length"`
+	MaxLength           int    `yaml:"max_length"`
+	MinCharacterClasses int    `yaml:"min_character_classes"`
+	BreachCorpus        string `yaml:"breach_corpus"` // Path to a sorted SHA-1 hash file
+}
+
+// HashConfig returns the settings for hashing new passwords
+func (c PasswordConfig) HashConfig() password.HashConfig {
+	config := password.DefaultHashConfig()
+	config.Algorithm = password.Algorithm(c.HashAlgorithm)
+	config.BcryptCost = c.BcryptCost
+	return config
+}
+
+// PolicyConfig returns the requirements for new passwords
+func (c PasswordConfig) PolicyConfig() password.PolicyConfig {
+	return password.PolicyConfig{
+		MinLength:           c.MinLength,
+		MaxLength:           c.MaxLength,
+		MinCharacterClasses: c.MinCharacterClasses,
+		BreachCorpusPath:    c.BreachCorpus,
+	}
+}
+
+// SiteConfig holds settings for feeds, sitemaps and robots.txt
+type SiteConfig struct {
+	Title             string   `yaml:"title"`
+	Description       string   `yaml:"description"`
+	FeedItems         int      `yaml:"feed_items"`
+	RobotsDisallow    []string `yaml:"robots_disallow"`
+	RobotsDisallowAll bool     `yaml:"robots_disallow_all"`
+}
+
+// OIDCConfig holds the OpenID Connect providers users can log in with
+type OIDCConfig struct {
+	Providers []OIDCProvider `yaml:"providers" env:"-"`
+}
+
+// OIDCProvider holds the settings of one OpenID Connect provider
+type OIDCProvider struct {
+	Name         string   `yaml:"name"` // Short name used in URLs, e.g. "google"
+	IssuerURL    string   `yaml:"issuer_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// Default returns the configuration used for settings that are not set
+// anywhere else
+func Default() Config {
+	pool := db.DefaultConfig()
+
+	return Config{
+		Mode: ModeProduction,
+		Server: ServerConfig{
+			Addr:            ":8080",
+			PublicURL:       "http://localhost:8080",
+			ShutdownTimeout: 10 * time.Second,
+			DrainDelay:      5 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			ServiceName: "blog",
+		},
+		Health: HealthConfig{
+			ReadyTimeout: 2 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    pool.MaxOpenConns,
+			MaxIdleConns:    pool.MaxIdleConns,
+			ConnMaxLifetime: pool.ConnMaxLifetime,
+			ConnMaxIdleTime: pool.ConnMaxIdleTime,
+			QueryTimeout:    pool.QueryTimeout,
+		},
+		JWT: JWTConfig{
+			Secret:        auth.PlaceholderSecretKey,
+			TokenDuration: 24 * time.Hour,
+		},
+		Mail: MailConfig{
+			SMTPPort:   587,
+			OutboxFile: "mail_outbox.jsonl",
+		},
+		Account: AccountConfig{
+			PasswordResetTTL:           time.Hour,
+			VerificationTTL:            48 * time.Hour,
+			VerificationResendInterval: 5 * time.Minute,
+			DeletedPostsPolicy:         "anonymize",
+			TwoFactorIssuer:            "Blog API",
+		},
+		Password: PasswordConfig{
+			HashAlgorithm:       "argon2id",
+			BcryptCost:          12,
+			MinLength:           8,
+			MaxLength:           72,
+			MinCharacterClasses: 2,
+		},
+		Site: SiteConfig{
+			Title:          "Blog",
+			Description:    "Latest posts",
+			FeedItems:      20,
+			RobotsDisallow: []string{"/auth/", "/users/me/"},
+		},
+	}
+}
+
+// IsDev reports whether the server runs in dev mode
+func (c Config) IsDev() bool {
+	return c.Mode == ModeDev
+}
+
+// Validate checks the configuration and returns every problem found
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Mode == ModeDev || c.Mode == ModeProduction,
+		"mode must be %q or %q, got %q", ModeDev, ModeProduction, c.Mode)
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(isHTTPURL(c.Server.PublicURL), "server.public_url must be an absolute http or https URL, got %q", c.Server.PublicURL)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == logging.FormatJSON || c.Log.Format == logging.FormatText,
+		"log.format must be %q or %q, got %q", logging.FormatJSON, logging.FormatText, c.Log.Format)
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		check(c.Tracing.Endpoint == "" || isHTTPURL(c.Tracing.Endpoint),
+			"tracing.endpoint must be an absolute http or https URL, got %q", c.Tracing.Endpoint)
+	default:
+		check(false, "tracing.exporter must be %q, %q or %q, got %q",
+			tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, c.Tracing.Exporter)
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+
+	check(c.Health.ReadyTimeout > 0, "health.ready_timeout must be positive")
+
+	check(c.Database.URL != "", "database.url is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns must not be more than database.max_open_conns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout must not be negative")
+
+	check(c.JWT.Secret != "", "jwt.secret is required")
+	if !c.IsDev() {
+		check(c.JWT.Secret != auth.PlaceholderSecretKey,
+			"jwt.secret is still the placeholder; set a real secret or run with mode %q", ModeDev)
+		check(len(c.JWT.Secret) >= minSecretLength,
+			"jwt.secret must be at least %d characters outside dev mode", minSecretLength)
+	}
+	check(c.JWT.TokenDuration > 0, "jwt.token_duration must be positive")
+
+	if c.Mail.SMTPHost != "" {
+		check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort < 65536, "mail.smtp_port must be between 1 and 65535")
+		check(c.Mail.From != "", "mail.from is required when mail.smtp_host is set")
+	} else {
+		check(c.Mail.OutboxFile != "", "mail.outbox_file is required when mail.smtp_host is not set")
+	}
+
+	check(c.Account.PasswordResetTTL > 0, "account.password_reset_ttl must be positive")
+	check(c.Account.VerificationTTL > 0, "account.verification_ttl must be positive")
+	check(c.Account.VerificationResendInterval >= 0, "account.verification_resend_interval must not be negative")
+	switch c.Account.DeletedPostsPolicy {
+	case "anonymize":
+	case "reassign":
+		check(c.Account.PostsReassignTo != "", "account.posts_reassign_to is required when deleted_posts_policy is \"reassign\"")
+	default:
+		check(false, "account.deleted_posts_policy must be \"anonymize\" or \"reassign\", got %q", c.Account.DeletedPostsPolicy)
+	}
+
+	check(c.Password.HashAlgorithm == "argon2id" || c.Password.HashAlgorithm == "bcrypt",
+		"password.hash_algorithm must be \"argon2id\" or \"bcrypt\", got %q", c.Password.HashAlgorithm)
+	check(c.Password.MinLength > 0, "password.min_length must be positive")
+	check(c.Password.MaxLength == 0 || c.Password.MaxLength >= c.Password.MinLength,
+		"password.max_length must be 0 or at least password.min_length")
+	check(c.Password.MinCharacterClasses >= 0 && c.Password.MinCharacterClasses <= 4,
+		"password.min_character_classes must be between 0 and 4")
+
+	check(c.Site.FeedItems > 0, "site.feed_items must be positive")
+
+	names := make(map[string]bool)
+	for i, p := range c.OIDC.Providers {
+		check(p.Name != "", "oidc.providers[%d].name is required", i)
+		check(!names[p.Name], "oidc.providers[%d].name %q is used twice", i, p.Name)
+		check(isHTTPURL(p.IssuerURL), "oidc.providers[%d].issuer_url must be an absolute http or https URL", i)
+		check(p.ClientID != "", "oidc.providers[%d].client_id is required", i)
+		names[p.Name] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
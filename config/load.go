@@ -0,0 +1,295 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix starts the name of every environment variable read by Load
+const envPrefix = "BLOG_"
+
+// durationType is the type of duration settings
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Loader registers the configuration flags on a flag set and loads the
+// configuration once the flags have been parsed. Every setting has a flag
+// named after its place in the YAML file, such as -server.addr, and an
+// environment variable such as BLOG_SERVER_ADDR.
+type Loader struct {
+	fs         *flag.FlagSet
+	configFile *string
+	values     map[string]*string // Flag values by flag name
+}
+
+// NewLoader registers the -config flag and one flag per setting on fs
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		fs:         fs,
+		configFile: fs.String("config", "", "path to a YAML configuration file (env "+envPrefix+"CONFIG)"),
+		values:     make(map[string]*string),
+	}
+
+	defaults := Default()
+	walkSettings(reflect.ValueOf(&defaults).Elem(), nil, func(path []string, _ reflect.Value) error {
+		name := flagName(path)
+		l.values[name] = fs.String(name, "", "overrides "+name+" (env "+envName(path)+")")
+		return nil
+	})
+
+	return l
+}
+
+// Load builds the configuration from defaults, the configuration file, the
+// environment and the parsed flags, then validates it
+func (l *Loader) Load() (Config, error) {
+	cfg := Default()
+
+	// Configuration file
+	path := *l.configFile
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	// Environment variables, including NAME_FILE variants for secrets
+	root := reflect.ValueOf(&cfg).Elem()
+	err := walkSettings(root, nil, func(path []string, field reflect.Value) error {
+		return applyEnv(envName(path), field)
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := applyOIDCEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	// Flags that were given on the command line
+	var flagErr error
+	l.fs.Visit(func(f *flag.Flag) {
+		value, ok := l.values[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		flagErr = walkSettings(root, nil, func(path []string, field reflect.Value) error {
+			if flagName(path) != f.Name {
+				return nil
+			}
+			if err := setValue(field, *value); err != nil {
+				return fmt.Errorf("flag -%s: %w", f.Name, err)
+			}
+			return nil
+		})
+	})
+	if flagErr != nil {
+		return Config{}, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return cfg, nil
+}
+
+// Load parses args (usually os.Args[1:]) as configuration flags and loads
+// the configuration
+func Load(name string, args []string) (Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	return loader.Load()
+}
+
+// loadFile decodes a YAML file over cfg. Unknown keys are an error, so that
+// typos don't go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv sets field from the environment variable name, or from the file
+// named by name_FILE
+func applyEnv(name string, field reflect.Value) error {
+	value, ok, err := lookupEnv(name)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := setValue(field, value); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// lookupEnv reads an environment variable, or the contents of the file
+// named by the same variable with a _FILE suffix, as used for Docker secrets
+func lookupEnv(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	file, fileOK := os.LookupEnv(name + "_FILE")
+
+	if ok && fileOK {
+		return "", false, fmt.Errorf("only one of %s and %s_FILE may be set", name, name)
+	}
+
+	if fileOK {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+
+	return value, ok, nil
+}
+
+// applyOIDCEnv adds the providers named in BLOG_OIDC_PROVIDERS and sets the
+// fields of every provider from BLOG_OIDC_<NAME>_<FIELD> variables, such as
+// BLOG_OIDC_GOOGLE_CLIENT_SECRET
+func applyOIDCEnv(cfg *Config) error {
+	names, _, err := lookupEnv(envPrefix + "OIDC_PROVIDERS")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !hasProvider(cfg.OIDC.Providers, name) {
+			cfg.OIDC.Providers = append(cfg.OIDC.Providers, OIDCProvider{Name: name})
+		}
+	}
+
+	for i := range cfg.OIDC.Providers {
+		provider := reflect.ValueOf(&cfg.OIDC.Providers[i]).Elem()
+		prefix := []string{"oidc", cfg.OIDC.Providers[i].Name}
+		err := walkSettings(provider, prefix, func(path []string, field reflect.Value) error {
+			if path[len(path)-1] == "name" {
+				return nil
+			}
+			return applyEnv(envName(path), field)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasProvider reports whether providers includes one called name
+func hasProvider(providers []OIDCProvider, name string) bool {
+	for _, p := range providers {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// walkSettings calls fn for every setting in the struct v, with its path of
+// YAML keys. Fields tagged env:"-" are skipped.
+func walkSettings(v reflect.Value, path []string, fn func(path []string, field reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("env") == "-" {
+			continue
+		}
+
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		fieldPath := append(append([]string{}, path...), key)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := walkSettings(v.Field(i), fieldPath, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := fn(fieldPath, v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setValue parses raw into a setting of any supported type. Lists are
+// comma-separated.
+func setValue(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", raw)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+
+	return nil
+}
+
+// envName returns the environment variable for a setting path
+func envName(path []string) string {
+	return envPrefix + strings.ToUpper(strings.Join(path, "_"))
+}
+
+// flagName returns the flag for a setting path
+func flagName(path []string) string {
+	return strings.Join(path, ".")
+}
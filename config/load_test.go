@@ -0,0 +1,224 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every BLOG_ variable for the rest of the test, so settings
+// from the environment running the tests don't leak in
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, envPrefix) {
+			t.Setenv(name, "") // Restores the variable when the test ends
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	// Every case runs in dev mode with a database URL, the only settings
+	// without a usable default
+	const base = "mode: dev\ndatabase:\n  url: postgres://localhost/blog\n"
+
+	tests := []struct {
+		name    string
+		files   map[string]string // Written to a temporary directory; {dir} in env and args is replaced by it
+		env     map[string]string
+		args    []string
+		get     func(Config) any
+		want    any
+		wantErr string // Part of the error message, if Load should fail
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{"BLOG_MODE": "dev", "BLOG_DATABASE_URL": "postgres://localhost/blog"},
+			get:  func(c Config) any { return c.Server.Addr },
+			want: ":8080",
+		},
+		{
+			name:  "file over defaults",
+			files: map[string]string{"config.yaml": base + "server:\n  addr: :9000\n"},
+			args:  []string{"-config", "{dir}/config.yaml"},
+			get:   func(c Config) any { return c.Server.Addr },
+			want:  ":9000",
+		},
+		{
+			name:  "file named in the environment",
+			files: map[string]string{"config.yaml": base + "server:\n  addr: :9000\n"},
+			env:   map[string]string{"BLOG_CONFIG": "{dir}/config.yaml"},
+			get:   func(c Config) any { return c.Server.Addr },
+			want:  ":9000",
+		},
+		{
+			name:  "config flag over config environment variable",
+			files: map[string]string{"config.yaml": base + "server:\n  addr: :9000\n", "other.yaml": base + "server:\n  addr: :9001\n"},
+			env:   map[string]string{"BLOG_CONFIG": "{dir}/config.yaml"},
+			args:  []string{"-config", "{dir}/other.yaml"},
+			get:   func(c Config) any { return c.Server.Addr },
+			want:  ":9001",
+		},
+		{
+			name:  "file leaves other settings at their defaults",
+			files: map[string]string{"config.yaml": base + "server:\n  addr: :9000\n"},
+			args:  []string{"-config", "{dir}/config.yaml"},
+			get:   func(c Config) any { return c.Server.ShutdownTimeout },
+			want:  10 * time.Second,
+		},
+		{
+			name:  "environment over file",
+			files: map[string]string{"config.yaml": base + "server:\n  addr: :9000\n"},
+			env:   map[string]string{"BLOG_SERVER_ADDR": ":9100"},
+			args:  []string{"-config", "{dir}/config.yaml"},
+			get:   func(c Config) any { return c.Server.Addr },
+			want:  ":9100",
+		},
+		{
+			name:  "flag over environment and file",
+			files: map[string]string{"config.yaml": base + "server:\n  addr: :9000\n"},
+			env:   map[string]string{"BLOG_SERVER_ADDR": ":9100"},
+			args:  []string{"-config", "{dir}/config.yaml", "-server.addr", ":9200"},
+			get:   func(c Config) any { return c.Server.Addr },
+			want:  ":9200",
+		},
+		{
+			name:  "flag over file",
+			files: map[string]string{"config.yaml": base + "server:\n  shutdown_timeout: 20s\n"},
+			args:  []string{"-config", "{dir}/config.yaml", "-server.shutdown_timeout", "30s"},
+			get:   func(c Config) any { return c.Server.ShutdownTimeout },
+			want:  30 * time.Second,
+		},
+		{
+			name:  "list from the environment",
+			files: map[string]string{"config.yaml": base + "site:\n  robots_disallow: [/admin]\n"},
+			env:   map[string]string{"BLOG_SITE_ROBOTS_DISALLOW": "/drafts, /private,"},
+			args:  []string{"-config", "{dir}/config.yaml"},
+			get:   func(c Config) any { return c.Site.RobotsDisallow },
+			want:  []string{"/drafts", "/private"},
+		},
+		{
+			name:  "secret from a file",
+			files: map[string]string{"config.yaml": base + "jwt:\n  secret: from-config-file\n", "secret": "from-secret-file\n"},
+			env:   map[string]string{"BLOG_JWT_SECRET_FILE": "{dir}/secret"},
+			args:  []string{"-config", "{dir}/config.yaml"},
+			get:   func(c Config) any { return c.JWT.Secret },
+			want:  "from-secret-file",
+		},
+		{
+			name:  "secret file with CRLF",
+			files: map[string]string{"config.yaml": base, "secret": "from-secret-file\r\n"},
+			env:   map[string]string{"BLOG_JWT_SECRET_FILE": "{dir}/secret"},
+			args:  []string{"-config", "{dir}/config.yaml"},
+			get:   func(c Config) any { return c.JWT.Secret },
+			want:  "from-secret-file",
+		},
+		{
+			name:  "flag over secret file",
+			files: map[string]string{"config.yaml": base, "secret": "from-secret-file\n"},
+			env:   map[string]string{"BLOG_JWT_SECRET_FILE": "{dir}/secret"},
+			args:  []string{"-config", "{dir}/config.yaml", "-jwt.secret", "from-flag"},
+			get:   func(c Config) any { return c.JWT.Secret },
+			want:  "from-flag",
+		},
+		{
+			name:  "OIDC provider secret from a file",
+			files: map[string]string{"config.yaml": base, "client-secret": "provider-secret\n"},
+			env: map[string]string{
+				"BLOG_OIDC_PROVIDERS":                 "google",
+				"BLOG_OIDC_GOOGLE_ISSUER_URL":         "https://accounts.google.com",
+				"BLOG_OIDC_GOOGLE_CLIENT_ID":          "client",
+				"BLOG_OIDC_GOOGLE_CLIENT_SECRET_FILE": "{dir}/client-secret",
+			},
+			args: []string{"-config", "{dir}/config.yaml"},
+			get:  func(c Config) any { return c.OIDC.Providers[0].ClientSecret },
+			want: "provider-secret",
+		},
+		{
+			name:    "variable and secret file both set",
+			files:   map[string]string{"config.yaml": base, "secret": "from-secret-file\n"},
+			env:     map[string]string{"BLOG_JWT_SECRET": "from-env", "BLOG_JWT_SECRET_FILE": "{dir}/secret"},
+			args:    []string{"-config", "{dir}/config.yaml"},
+			wantErr: "only one of BLOG_JWT_SECRET and BLOG_JWT_SECRET_FILE may be set",
+		},
+		{
+			name:    "missing secret file",
+			files:   map[string]string{"config.yaml": base},
+			env:     map[string]string{"BLOG_JWT_SECRET_FILE": "{dir}/missing"},
+			args:    []string{"-config", "{dir}/config.yaml"},
+			wantErr: "BLOG_JWT_SECRET_FILE",
+		},
+		{
+			name:    "missing config file",
+			args:    []string{"-config", "{dir}/missing.yaml"},
+			wantErr: "reading config file",
+		},
+		{
+			name:    "unknown key in file",
+			files:   map[string]string{"config.yaml": base + "server:\n  adr: :9000\n"},
+			args:    []string{"-config", "{dir}/config.yaml"},
+			wantErr: "field adr not found",
+		},
+		{
+			name:    "invalid environment value",
+			files:   map[string]string{"config.yaml": base},
+			env:     map[string]string{"BLOG_SERVER_SHUTDOWN_TIMEOUT": "soon"},
+			args:    []string{"-config", "{dir}/config.yaml"},
+			wantErr: "BLOG_SERVER_SHUTDOWN_TIMEOUT",
+		},
+		{
+			name:    "invalid flag value",
+			files:   map[string]string{"config.yaml": base},
+			args:    []string{"-config", "{dir}/config.yaml", "-database.max_open_conns", "many"},
+			wantErr: "flag -database.max_open_conns",
+		},
+		{
+			name:    "validated after every source",
+			files:   map[string]string{"config.yaml": base},
+			env:     map[string]string{"BLOG_MODE": "production"},
+			args:    []string{"-config", "{dir}/config.yaml"},
+			wantErr: "jwt.secret is still the placeholder",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+
+			dir := t.TempDir()
+			for name, contents := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, strings.ReplaceAll(value, "{dir}", dir))
+			}
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = strings.ReplaceAll(arg, "{dir}", dir)
+			}
+
+			cfg, err := Load("blog", args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			if got := tt.get(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
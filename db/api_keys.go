@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"blog2/auth"
+	"blog2/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+// apiKeyColumns lists the columns read into a models.APIKey by scanAPIKey
+const apiKeyColumns = `id, name, prefix, scopes, expires_at, last_used_at, date_created`
+
+// scanAPIKey reads an API key selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(
+		&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.DateCreated,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// CreateAPIKey stores a new API key for a user
+func (db *DB) CreateAPIKey(ctx context.Context, userID int, name string, prefix string, keyHash string, scopes []string, expiresAt *time.Time) (models.APIKey, error) {
+	ctx, end := db.operation(ctx, "CreateAPIKey")
+	defer end()
+
+	return scanAPIKey(db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) 
+		VALUES ($1, $2, $3, $4, $5, $6) 
+		RETURNING `+apiKeyColumns,
+		userID, name, prefix, keyHash, pq.Array(scopes), expiresAt,
+	))
+}
+
+// GetAPIKeysByUser retrieves the unrevoked API keys of a user
+func (db *DB) GetAPIKeysByUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	ctx, end := db.operation(ctx, "GetAPIKeysByUser")
+	defer end()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+` 
+		FROM api_keys 
+		WHERE user_id = $1 AND revoked_at IS NULL 
+		ORDER BY date_created DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of a user's API keys
+func (db *DB) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	ctx, end := db.operation(ctx, "RevokeAPIKey")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE api_keys 
+		SET revoked_at = NOW() 
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// RevokeAllAPIKeys revokes every API key of a user and returns how many
+// were revoked
+func (db *DB) RevokeAllAPIKeys(ctx context.Context, userID int) (int64, error) {
+	ctx, end := db.operation(ctx, "RevokeAllAPIKeys")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE api_keys 
+		SET revoked_at = NOW() 
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// AuthenticateAPIKey checks an API key and returns claims for its user,
+// limited to the key's scopes. It implements auth.CredentialStore.
+func (db *DB) AuthenticateAPIKey(ctx context.Context, key string) (models.TokenClaims, error) {
+	ctx, end := db.operation(ctx, "AuthenticateAPIKey")
+	defer end()
+
+	prefix, err := auth.ParseAPIKeyPrefix(key)
+	if err != nil {
+		return models.TokenClaims{}, err
+	}
+
+	var keyID int
+	var keyHash string
+	var claims models.TokenClaims
+	err = db.QueryRowContext(ctx, `
+		SELECT k.id, k.key_hash, k.scopes, u.id, u.username 
+		FROM api_keys k 
+		JOIN users u ON u.id = k.user_id 
+		WHERE k.prefix = $1 AND k.revoked_at IS NULL 
+		AND (k.expires_at IS NULL OR k.expires_at > NOW())
+	`, prefix).Scan(&keyID, &keyHash, pq.Array(&claims.Scopes), &claims.UserID, &claims.Username)
+
+	if err == sql.ErrNoRows {
+		return models.TokenClaims{}, auth.ErrInvalidAPIKey
+	}
+
+	if err != nil {
+		return models.TokenClaims{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(key)), []byte(keyHash)) != 1 {
+		return models.TokenClaims{}, auth.ErrInvalidAPIKey
+	}
+
+	// Only write last_used_at once a minute to keep busy keys cheap
+	_, err = db.ExecContext(ctx, `
+		UPDATE api_keys 
+		SET last_used_at = NOW() 
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, keyID)
+	if err != nil {
+		return models.TokenClaims{}, err
+	}
+
+	claims.APIKeyID = keyID
+	if claims.Scopes == nil {
+		claims.Scopes = []string{}
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"blog2/models"
+)
+
+var (
+	ErrCannotFollowSelf = errors.New("users cannot follow themselves")
+)
+
+// Follow makes followerID follow followeeID. Following someone twice has no
+// further effect.
+func (db *DB) Follow(ctx context.Context, followerID int, followeeID int) error {
+	ctx, end := db.operation(ctx, "Follow")
+	defer end()
+
+	if followerID == followeeID {
+		return ErrCannotFollowSelf
+	}
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO follows (follower_id, followee_id) 
+		VALUES ($1, $2) 
+		ON CONFLICT (follower_id, followee_id) DO NOTHING
+	`, followerID, followeeID)
+
+	return err
+}
+
+// Unfollow stops followerID following followeeID, if they did
+func (db *DB) Unfollow(ctx context.Context, followerID int, followeeID int) error {
+	ctx, end := db.operation(ctx, "Unfollow")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM follows 
+		WHERE follower_id = $1 AND followee_id = $2
+	`, followerID, followeeID)
+
+	return err
+}
+
+// GetFollowCounts returns how many users follow userID and how many userID
+// follows. Users with private profiles are not counted.
+func (db *DB) GetFollowCounts(ctx context.Context, userID int) (followers int, following int, err error) {
+	ctx, end := db.operation(ctx, "GetFollowCounts")
+	defer end()
+
+	err = db.QueryRowContext(ctx, `
+		SELECT 
+			(SELECT COUNT(*) FROM follows f JOIN users u ON u.id = f.follower_id 
+				WHERE f.followee_id = $1 AND NOT u.profile_private), 
+			(SELECT COUNT(*) FROM follows f JOIN users u ON u.id = f.followee_id 
+				WHERE f.follower_id = $1 AND NOT u.profile_private)
+	`, userID).Scan(&followers, &following)
+
+	return followers, following, err
+}
+
+// GetFollowers returns up to limit users following userID, most recent
+// first. Pass a zero before time for the first page, or the FollowedAt and
+// UserID of the last entry of the previous page.
+func (db *DB) GetFollowers(ctx context.Context, userID int, before time.Time, beforeID int, limit int) ([]models.FollowEntry, error) {
+	ctx, end := db.operation(ctx, "GetFollowers")
+	defer end()
+
+	return db.getFollowList(ctx, `
+		SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.website, u.date_created, f.date_created 
+		FROM follows f 
+		JOIN users u ON u.id = f.follower_id 
+		WHERE f.followee_id = $1 AND NOT u.profile_private 
+			AND (f.date_created, f.follower_id) < ($2, $3) 
+		ORDER BY f.date_created DESC, f.follower_id DESC 
+		LIMIT $4
+	`, userID, before, beforeID, limit)
+}
+
+// GetFollowing returns up to limit users that userID follows, most recent
+// first, paginated like GetFollowers
+func (db *DB) GetFollowing(ctx context.Context, userID int, before time.Time, beforeID int, limit int) ([]models.FollowEntry, error) {
+	ctx, end := db.operation(ctx, "GetFollowing")
+	defer end()
+
+	return db.getFollowList(ctx, `
+		SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.website, u.date_created, f.date_created 
+		FROM follows f 
+		JOIN users u ON u.id = f.followee_id 
+		WHERE f.follower_id = $1 AND NOT u.profile_private 
+			AND (f.date_created, f.followee_id) < ($2, $3) 
+		ORDER BY f.date_created DESC, f.followee_id DESC 
+		LIMIT $4
+	`, userID, before, beforeID, limit)
+}
+
+// getFollowList runs a follower or following query
+func (db *DB) getFollowList(ctx context.Context, query string, userID int, before time.Time, beforeID int, limit int) ([]models.FollowEntry, error) {
+	before, beforeID = keysetStart(before, beforeID)
+	rows, err := db.QueryContext(ctx, query, userID, before, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.FollowEntry{}
+	for rows.Next() {
+		var e models.FollowEntry
+		err := rows.Scan(
+			&e.UserID, &e.Username, &e.DisplayName, &e.Bio, &e.AvatarURL, &e.Website, &e.DateCreated, &e.FollowedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetTimeline returns up to limit posts by the authors userID follows,
+// newest first. Authors whose profile is private now are left out, even if
+// it was public when they were followed. Pass a zero before time for the
+// first page, or the DateCreated and ID of the last post of the previous page.
+//
+// Each followed author's newest posts are read separately through
+// idx_posts_author_date and merged, so the cost grows with the page size
+// times the number of authors followed rather than with their total posts.
+func (db *DB) GetTimeline(ctx context.Context, userID int, before time.Time, beforeID int, limit int) ([]models.Post, error) {
+	ctx, end := db.operation(ctx, "GetTimeline")
+	defer end()
+
+	before, beforeID = keysetStart(before, beforeID)
+	return scanPosts(db.QueryContext(ctx, `
+		SELECT `+postColumns+` 
+		FROM follows f 
+		JOIN users u ON u.id = f.followee_id 
+		CROSS JOIN LATERAL (
+			SELECT * 
+			FROM posts 
+			WHERE created_by = u.username 
+				AND (date_created, id) < ($2, $3) 
+			ORDER BY date_created DESC, id DESC 
+			LIMIT $4
+		) p `+postViewerJoins+` 
+		WHERE f.follower_id = $1 AND NOT u.profile_private 
+		ORDER BY p.date_created DESC, p.id DESC 
+		LIMIT $4
+	`, userID, before, beforeID, limit))
+}
+
+// keysetStart replaces a zero before time with a position past every row,
+// so the first page uses the same index-friendly comparison as later ones
+func keysetStart(before time.Time, beforeID int) (time.Time, int) {
+	if before.IsZero() {
+		return time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), math.MaxInt32
+	}
+	return before, beforeID
+}
@@ -0,0 +1,73 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"blog2/db/dbtest"
+	"blog2/models"
+)
+
+func TestGetTimelineLeavesOutPrivateAuthors(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	users := make(map[string]models.User)
+	for _, username := range []string{"reader", "alice", "bob"} {
+		user, err := database.CreateUser(ctx, models.NewUser{Username: username, Email: username + "@example.com", Password: "correct horse battery"})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		users[username] = user
+
+		if username == "reader" {
+			continue
+		}
+		if err := database.Follow(ctx, users["reader"].ID, user.ID); err != nil {
+			t.Fatalf("Follow: %v", err)
+		}
+		if _, err := database.CreatePost(ctx, models.NewPost{Title: "By " + username, Content: "Hello", CreatedBy: username}); err != nil {
+			t.Fatalf("CreatePost: %v", err)
+		}
+	}
+
+	timelineAuthors := func() map[string]bool {
+		t.Helper()
+
+		posts, err := database.GetTimeline(ctx, users["reader"].ID, time.Time{}, 0, 20)
+		if err != nil {
+			t.Fatalf("GetTimeline: %v", err)
+		}
+
+		authors := make(map[string]bool)
+		for _, post := range posts {
+			authors[post.CreatedBy] = true
+		}
+		return authors
+	}
+
+	setPrivate := func(username string, private bool) {
+		t.Helper()
+
+		if _, err := database.UpdateProfile(ctx, users[username].ID, models.UpdateUserRequest{ProfilePrivate: &private}); err != nil {
+			t.Fatalf("UpdateProfile: %v", err)
+		}
+	}
+
+	if authors := timelineAuthors(); !authors["alice"] || !authors["bob"] {
+		t.Fatalf("timeline authors = %v, want alice and bob", authors)
+	}
+
+	// Going private after being followed hides the author's posts
+	setPrivate("bob", true)
+	if authors := timelineAuthors(); !authors["alice"] || authors["bob"] {
+		t.Errorf("timeline authors with bob private = %v, want only alice", authors)
+	}
+
+	// Going public again brings them back
+	setPrivate("bob", false)
+	if authors := timelineAuthors(); !authors["alice"] || !authors["bob"] {
+		t.Errorf("timeline authors with bob public again = %v, want alice and bob", authors)
+	}
+}
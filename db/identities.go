@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"blog2/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrIdentityAlreadyLinked = errors.New("identity is already linked to a user")
+	ErrLastLoginMethod       = errors.New("cannot remove the only way to log in")
+)
+
+// unusablePasswordHash is stored for users created through an external
+// identity provider. It never matches any password.
+const unusablePasswordHash = "!"
+
+// uniqueViolation is the Postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// identityColumns lists the columns read into a models.UserIdentity by scanIdentity
+const identityColumns = `id, user_id, provider, subject, COALESCE(email, ''), date_created`
+
+// scanIdentity reads an identity selected with identityColumns
+func scanIdentity(row rowScanner) (models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := row.Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.DateCreated,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.UserIdentity{}, ErrIdentityNotFound
+	}
+
+	if err != nil {
+		return models.UserIdentity{}, err
+	}
+
+	return identity, nil
+}
+
+// GetIdentity retrieves the identity for a provider's subject
+func (db *DB) GetIdentity(ctx context.Context, provider string, subject string) (models.UserIdentity, error) {
+	ctx, end := db.operation(ctx, "GetIdentity")
+	defer end()
+
+	return scanIdentity(db.QueryRowContext(ctx, `
+		SELECT `+identityColumns+` 
+		FROM user_identities 
+		WHERE provider = $1 AND subject = $2
+	`, provider, subject))
+}
+
+// GetIdentitiesByUser retrieves all identities linked to a user
+func (db *DB) GetIdentitiesByUser(ctx context.Context, userID int) ([]models.UserIdentity, error) {
+	ctx, end := db.operation(ctx, "GetIdentitiesByUser")
+	defer end()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+identityColumns+` 
+		FROM user_identities 
+		WHERE user_id = $1 
+		ORDER BY date_created
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// CreateIdentity links a provider's subject to an existing user
+func (db *DB) CreateIdentity(ctx context.Context, userID int, provider string, subject string, email string) (models.UserIdentity, error) {
+	ctx, end := db.operation(ctx, "CreateIdentity")
+	defer end()
+
+	identity, err := scanIdentity(db.QueryRowContext(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email) 
+		VALUES ($1, $2, $3, NULLIF($4, '')) 
+		RETURNING `+identityColumns,
+		userID, provider, subject, email,
+	))
+
+	if isUniqueViolation(err) {
+		return models.UserIdentity{}, ErrIdentityAlreadyLinked
+	}
+
+	return identity, err
+}
+
+// DeleteIdentity unlinks an identity from a user. It returns
+// ErrLastLoginMethod if the user has no password and no other identity.
+func (db *DB) DeleteIdentity(ctx context.Context, userID int, identityID int) error {
+	ctx, end := db.operation(ctx, "DeleteIdentity")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasPassword bool
+	var identityCount int
+	err = tx.QueryRowContext(ctx, `
+		SELECT u.password_hash <> $2, 
+			(SELECT COUNT(*) FROM user_identities WHERE user_id = u.id) 
+		FROM users u 
+		WHERE u.id = $1 
+		FOR UPDATE
+	`, userID, unusablePasswordHash).Scan(&hasPassword, &identityCount)
+
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_identities WHERE id = $1 AND user_id = $2`, identityID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrIdentityNotFound
+	}
+
+	if !hasPassword && identityCount <= 1 {
+		return ErrLastLoginMethod
+	}
+
+	return tx.Commit()
+}
+
+// AvailableUsername returns base, or base with a numeric suffix, such that no
+// user has that username yet
+func (db *DB) AvailableUsername(ctx context.Context, base string) (string, error) {
+	ctx, end := db.operation(ctx, "AvailableUsername")
+	defer end()
+
+	candidate := base
+	for i := 2; i < 1000; i++ {
+		var exists bool
+		err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`, candidate).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+
+	return "", ErrUserAlreadyExists
+}
+
+// CreateExternalUser adds a user who signed up through an identity provider,
+// together with the identity. The user has no password until they set one
+// through a password reset.
+func (db *DB) CreateExternalUser(ctx context.Context, username string, email string, emailVerified bool, provider string, subject string) (models.User, error) {
+	ctx, end := db.operation(ctx, "CreateExternalUser")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRowContext(ctx, `
+		INSERT INTO users (username, email, password_hash, email_verified_at) 
+		VALUES ($1, $2, $3, CASE WHEN $4 THEN NOW() END) 
+		RETURNING `+userColumns,
+		username, email, unusablePasswordHash, emailVerified,
+	))
+
+	if isUniqueViolation(err) {
+		return models.User{}, ErrUserAlreadyExists
+	}
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email) 
+		VALUES ($1, $2, $3, $4)
+	`, user.ID, provider, subject, email)
+
+	if isUniqueViolation(err) {
+		return models.User{}, ErrIdentityAlreadyLinked
+	}
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Lockout scopes
+const (
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+)
+
+// RecordLoginAttempt stores the outcome of a login attempt
+func (db *DB) RecordLoginAttempt(ctx context.Context, username string, ip string, success bool) error {
+	ctx, end := db.operation(ctx, "RecordLoginAttempt")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO login_attempts (username, ip, success) 
+		VALUES ($1, $2, $3)
+	`, username, ip, success)
+
+	return err
+}
+
+// CountFailedLogins returns the number of failed logins since the given time
+// for the username and for the IP address. Failures for the username made
+// before its last successful login are not counted.
+func (db *DB) CountFailedLogins(ctx context.Context, username string, ip string, since time.Time) (int, int, error) {
+	ctx, end := db.operation(ctx, "CountFailedLogins")
+	defer end()
+
+	var accountFailures, ipFailures int
+	err := db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM login_attempts 
+			 WHERE username = $1 AND NOT success 
+			 AND attempted_at > GREATEST($3, (
+				SELECT MAX(attempted_at) FROM login_attempts WHERE username = $1 AND success
+			 ))),
+			(SELECT COUNT(*) FROM login_attempts 
+			 WHERE ip = $2 AND NOT success AND attempted_at > $3)
+	`, username, ip, since).Scan(&accountFailures, &ipFailures)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return accountFailures, ipFailures, nil
+}
+
+// CreateLockout records a temporary lockout for the account or IP address
+func (db *DB) CreateLockout(ctx context.Context, scope string, username string, ip string, failures int, lockedUntil time.Time) error {
+	ctx, end := db.operation(ctx, "CreateLockout")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO account_lockouts (scope, username, ip, failures, locked_until) 
+		VALUES ($1, $2, $3, $4, $5)
+	`, scope, username, ip, failures, lockedUntil)
+
+	return err
+}
+
+// GetActiveLockout returns when the latest lockout covering the username or
+// IP address ends. The returned time is nil if neither is locked out.
+func (db *DB) GetActiveLockout(ctx context.Context, username string, ip string) (*time.Time, error) {
+	ctx, end := db.operation(ctx, "GetActiveLockout")
+	defer end()
+
+	var lockedUntil sql.NullTime
+	err := db.QueryRowContext(ctx, `
+		SELECT MAX(locked_until) 
+		FROM account_lockouts 
+		WHERE locked_until > NOW() 
+		AND ((scope = $1 AND username = $3) OR (scope = $2 AND ip = $4))
+	`, LockoutScopeAccount, LockoutScopeIP, username, ip).Scan(&lockedUntil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !lockedUntil.Valid {
+		return nil, nil
+	}
+
+	return &lockedUntil.Time, nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"blog2/models"
+)
+
+// reactionCounts computes the reaction counters of every post from
+// post_reactions, for comparison with the denormalised columns
+const reactionCounts = `
+	SELECT p.id, 
+		COUNT(r.reaction) FILTER (WHERE r.reaction = 'like') AS like_count, 
+		COUNT(r.reaction) FILTER (WHERE r.reaction = 'love') AS love_count, 
+		COUNT(r.reaction) FILTER (WHERE r.reaction = 'laugh') AS laugh_count, 
+		COUNT(r.reaction) FILTER (WHERE r.reaction = 'wow') AS wow_count, 
+		COUNT(r.reaction) FILTER (WHERE r.reaction = 'sad') AS sad_count 
+	FROM posts p 
+	LEFT JOIN post_reactions r ON r.post_id = p.id 
+	GROUP BY p.id`
+
+// reactionCountsDiffer matches posts p whose counters differ from the counts c
+const reactionCountsDiffer = `(p.like_count, p.love_count, p.laugh_count, p.wow_count, p.sad_count) 
+	IS DISTINCT FROM (c.like_count, c.love_count, c.laugh_count, c.wow_count, c.sad_count)`
+
+// ImportPost adds a post with its original author and dates. A post with the
+// same author, title and creation time is assumed to have been imported
+// already and is skipped, in which case imported is false.
+func (db *DB) ImportPost(ctx context.Context, p models.Post) (imported bool, err error) {
+	ctx, end := db.operation(ctx, "ImportPost")
+	defer end()
+
+	dateUpdated := p.DateUpdated
+	if dateUpdated.IsZero() {
+		dateUpdated = p.DateCreated
+	}
+
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO posts (title, content, created_by, date_created, date_updated) 
+		SELECT $1, $2, $3, $4, $5 
+		WHERE NOT EXISTS (
+			SELECT 1 FROM posts WHERE created_by = $3 AND title = $1 AND date_created = $4
+		)
+	`, p.Title, p.Content, p.CreatedBy, p.DateCreated, dateUpdated)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CheckIntegrity looks for data that the schema can't rule out but the
+// application never writes: reaction counters that disagree with the
+// reactions, and posts attributed to users that don't exist. Posts by
+// anonymousAuthor belong to deleted accounts and are expected.
+func (db *DB) CheckIntegrity(ctx context.Context, anonymousAuthor string) ([]models.IntegrityIssue, error) {
+	ctx, end := db.operation(ctx, "CheckIntegrity")
+	defer end()
+
+	issues := []models.IntegrityIssue{}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.id 
+		FROM posts p 
+		JOIN (`+reactionCounts+`) c ON c.id = p.id 
+		WHERE `+reactionCountsDiffer+` 
+		ORDER BY p.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		issues = append(issues, models.IntegrityIssue{
+			Check:  "reaction_counts",
+			Detail: fmt.Sprintf("post %d has reaction counters that don't match its reactions", id),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT p.created_by, COUNT(*) 
+		FROM posts p 
+		WHERE p.created_by <> $1 
+			AND NOT EXISTS (SELECT 1 FROM users u WHERE u.username = p.created_by) 
+		GROUP BY p.created_by 
+		ORDER BY p.created_by
+	`, anonymousAuthor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var author string
+		var count int
+		if err := rows.Scan(&author, &count); err != nil {
+			return nil, err
+		}
+		issues = append(issues, models.IntegrityIssue{
+			Check:  "post_authors",
+			Detail: fmt.Sprintf("%d posts are attributed to %q, who is not a user", count, author),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// RecountReactions recomputes the reaction counters of every post whose
+// counters are wrong and returns how many posts were fixed
+func (db *DB) RecountReactions(ctx context.Context) (int64, error) {
+	ctx, end := db.operation(ctx, "RecountReactions")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		WITH c AS (`+reactionCounts+`) 
+		UPDATE posts p 
+		SET like_count = c.like_count, love_count = c.love_count, laugh_count = c.laugh_count, 
+			wow_count = c.wow_count, sad_count = c.sad_count 
+		FROM c 
+		WHERE c.id = p.id AND `+reactionCountsDiffer)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
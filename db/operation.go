@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of database methods
+var tracer = otel.Tracer("blog2/db")
+
+// operation prepares ctx for the database method name: it starts a span for
+// the method as a child of the span in ctx, and limits the method to
+// QueryTimeout. The method must run its queries with the returned context
+// and call the returned function when it is done.
+func (db *DB) operation(ctx context.Context, name string) (context.Context, func()) {
+	ctx, span := tracer.Start(ctx, "db."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNamePostgreSQL),
+	)
+
+	if db.QueryTimeout <= 0 {
+		return ctx, func() { span.End() }
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	return ctx, func() {
+		cancel()
+		span.End()
+	}
+}
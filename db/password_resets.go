@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"blog2/models"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+)
+
+// CreatePasswordResetToken stores the hash of a newly issued reset token
+func (db *DB) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	ctx, end := db.operation(ctx, "CreatePasswordResetToken")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) 
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+
+	return err
+}
+
+// GetPasswordResetUser retrieves the user a valid, unused reset token was
+// issued to
+func (db *DB) GetPasswordResetUser(ctx context.Context, tokenHash string) (models.User, error) {
+	ctx, end := db.operation(ctx, "GetPasswordResetUser")
+	defer end()
+
+	user, err := scanUser(db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` 
+		FROM users 
+		WHERE id = (
+			SELECT user_id 
+			FROM password_reset_tokens 
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		)
+	`, tokenHash))
+
+	if errors.Is(err, ErrUserNotFound) {
+		return models.User{}, ErrInvalidResetToken
+	}
+
+	return user, err
+}
+
+// ResetPassword redeems a reset token and sets a new password for its user.
+// The token and any other outstanding tokens for the user are invalidated,
+// and all of the user's sessions are revoked.
+func (db *DB) ResetPassword(ctx context.Context, tokenHash string, newPassword string) error {
+	ctx, end := db.operation(ctx, "ResetPassword")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the token row so concurrent requests cannot redeem it twice
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id 
+		FROM password_reset_tokens 
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() 
+		FOR UPDATE
+	`, tokenHash).Scan(&userID)
+
+	if err == sql.ErrNoRows {
+		return ErrInvalidResetToken
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Hash the new password
+	hashedPassword, err := db.Hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users 
+		SET password_hash = $1 
+		WHERE id = $2
+	`, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+
+	// Mark every outstanding token for the user as used
+	_, err = tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens 
+		SET used_at = NOW() 
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	// Log out everywhere, the old password may have been compromised
+	if err := revokeOtherSessions(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
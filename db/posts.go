@@ -1,52 +1,124 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"sync"
+	"time"
 
 	_ "github.com/lib/pq"
 	"blog2/models"
+	"blog2/password"
 )
 
 var (
 	ErrNotFound = errors.New("post not found")
 )
 
+// Config holds settings for the database connection
+type Config struct {
+	URL             string        // PostgreSQL connection string
+	MaxOpenConns    int           // Connections open at once, including idle ones; 0 is unlimited
+	MaxIdleConns    int           // Idle connections kept for reuse
+	ConnMaxLifetime time.Duration // Connections are closed after this long; 0 keeps them forever
+	ConnMaxIdleTime time.Duration // Idle connections are closed after this long; 0 keeps them forever
+	QueryTimeout    time.Duration // Longest a database method may take; 0 is no limit
+}
+
+// DefaultConfig returns a default database configuration
+func DefaultConfig() Config {
+	return Config{
+		MaxOpenConns:    25,
+		MaxIdleConns:    10,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		QueryTimeout:    5 * time.Second,
+	}
+}
+
 // DB represents a database connection
 type DB struct {
 	*sql.DB
+	Hasher       *password.Hasher // Hashes and verifies user passwords
+	QueryTimeout time.Duration    // Longest a method may take; 0 is no limit
+
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
-// NewDB creates a new database connection
-func NewDB(connStr string) (*DB, error) {
-	db, err := sql.Open("postgres", connStr)
+// NewDB creates a new database connection pool
+func NewDB(config Config) (*DB, error) {
+	db, err := sql.Open("postgres", config.URL)
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
 	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	hasher, err := password.NewHasher(password.DefaultHashConfig())
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db, Hasher: hasher, QueryTimeout: config.QueryTimeout}, nil
 }
 
-// GetPosts retrieves all posts from the database
-func (db *DB) GetPosts() ([]models.Post, error) {
-	rows, err := db.Query(`
-		SELECT id, title, content, date_created, created_by 
-		FROM posts 
-		ORDER BY date_created DESC
-	`)
+// postColumns lists the columns read into a models.Post by scanPost. Queries
+// select them from posts aliased p, joined to the viewer's reaction and
+// bookmark with postViewerJoins.
+const postColumns = `p.id, p.title, p.content, p.date_created, p.date_updated, p.created_by,
+	p.like_count, p.love_count, p.laugh_count, p.wow_count, p.sad_count,
+	COALESCE(r.reaction, ''), b.post_id IS NOT NULL`
+
+// postViewerJoins joins the reaction and bookmark of the viewer, whose user
+// ID must be the first query parameter. A viewer ID of 0 matches nothing.
+const postViewerJoins = `
+	LEFT JOIN post_reactions r ON r.post_id = p.id AND r.user_id = $1 
+	LEFT JOIN bookmarks b ON b.post_id = p.id AND b.user_id = $1`
+
+// scanPost reads a post selected with postColumns
+func scanPost(row rowScanner) (models.Post, error) {
+	var p models.Post
+	var like, love, laugh, wow, sad int
+	err := row.Scan(
+		&p.ID, &p.Title, &p.Content, &p.DateCreated, &p.DateUpdated, &p.CreatedBy,
+		&like, &love, &laugh, &wow, &sad,
+		&p.MyReaction, &p.Bookmarked,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.Post{}, ErrNotFound
+	}
+
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	p.Reactions = map[string]int{"like": like, "love": love, "laugh": laugh, "wow": wow, "sad": sad}
+	return p, nil
+}
+
+// scanPosts reads all rows of a query selecting postColumns
+func scanPosts(rows *sql.Rows, err error) ([]models.Post, error) {
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []models.Post
+	posts := []models.Post{}
 	for rows.Next() {
-		var p models.Post
-		if err := rows.Scan(&p.ID, &p.Title, &p.Content, &p.DateCreated, &p.CreatedBy); err != nil {
+		p, err := scanPost(rows)
+		if err != nil {
 			return nil, err
 		}
 		posts = append(posts, p)
@@ -59,70 +131,179 @@ func (db *DB) GetPosts() ([]models.Post, error) {
 	return posts, nil
 }
 
-// GetPost retrieves a single post by ID
-func (db *DB) GetPost(id int) (models.Post, error) {
-	var p models.Post
-	err := db.QueryRow(`
-		SELECT id, title, content, date_created, created_by 
-		FROM posts 
-		WHERE id = $1
-	`, id).Scan(&p.ID, &p.Title, &p.Content, &p.DateCreated, &p.CreatedBy)
+// GetPosts retrieves all posts from the database, as seen by viewerID
+func (db *DB) GetPosts(ctx context.Context, viewerID int) ([]models.Post, error) {
+	ctx, end := db.operation(ctx, "GetPosts")
+	defer end()
 
-	if err == sql.ErrNoRows {
-		return models.Post{}, ErrNotFound
-	}
+	return scanPosts(db.QueryContext(ctx, `
+		SELECT `+postColumns+` 
+		FROM posts p `+postViewerJoins+` 
+		ORDER BY p.date_created DESC
+	`, viewerID))
+}
 
-	if err != nil {
-		return models.Post{}, err
-	}
+// GetPostsByAuthor retrieves all posts by one author, newest first, as seen
+// by viewerID
+func (db *DB) GetPostsByAuthor(ctx context.Context, username string, viewerID int) ([]models.Post, error) {
+	ctx, end := db.operation(ctx, "GetPostsByAuthor")
+	defer end()
 
-	return p, nil
+	return scanPosts(db.QueryContext(ctx, `
+		SELECT `+postColumns+` 
+		FROM posts p `+postViewerJoins+` 
+		WHERE p.created_by = $2 
+		ORDER BY p.date_created DESC
+	`, viewerID, username))
 }
 
-// CreatePost adds a new post to the database
-func (db *DB) CreatePost(np models.NewPost) (models.Post, error) {
-	var p models.Post
-	err := db.QueryRow(`
-		INSERT INTO posts (title, content, created_by) 
-		VALUES ($1, $2, $3) 
-		RETURNING id, title, content, date_created, created_by
-	`, np.Title, np.Content, np.CreatedBy).Scan(
-		&p.ID, &p.Title, &p.Content, &p.DateCreated, &p.CreatedBy,
-	)
+// GetLatestPosts retrieves the newest posts for public feeds, optionally
+// only those by one author. Posts by users with private profiles are left
+// out.
+func (db *DB) GetLatestPosts(ctx context.Context, author string, limit int) ([]models.Post, error) {
+	ctx, end := db.operation(ctx, "GetLatestPosts")
+	defer end()
+
+	return scanPosts(db.QueryContext(ctx, `
+		SELECT `+postColumns+` 
+		FROM posts p `+postViewerJoins+` 
+		WHERE ($2 = '' OR p.created_by = $2) AND `+publicPostsFilter+` 
+		ORDER BY p.date_created DESC, p.id DESC 
+		LIMIT $3
+	`, 0, author, limit))
+}
+
+// publicPostsFilter leaves out posts by users with private profiles, for
+// queries over posts aliased p
+const publicPostsFilter = `NOT EXISTS (
+	SELECT 1 FROM users u WHERE u.username = p.created_by AND u.profile_private
+)`
+
+// GetSitemapPageDates splits the public posts, ordered by ID, into pages of
+// pageSize and returns the latest edit time in each page
+func (db *DB) GetSitemapPageDates(ctx context.Context, pageSize int) ([]time.Time, error) {
+	ctx, end := db.operation(ctx, "GetSitemapPageDates")
+	defer end()
 
+	rows, err := db.QueryContext(ctx, `
+		SELECT (n - 1) / $1 AS page, MAX(date_updated) 
+		FROM (
+			SELECT p.date_updated, ROW_NUMBER() OVER (ORDER BY p.id) AS n 
+			FROM posts p 
+			WHERE `+publicPostsFilter+`
+		) numbered 
+		GROUP BY page 
+		ORDER BY page
+	`, pageSize)
 	if err != nil {
-		return models.Post{}, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return p, nil
+	dates := []time.Time{}
+	for rows.Next() {
+		var page int
+		var date time.Time
+		if err := rows.Scan(&page, &date); err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return dates, nil
 }
 
-// UpdatePost modifies an existing post
-func (db *DB) UpdatePost(id int, up models.UpdatePost) (models.Post, error) {
-	var p models.Post
-	err := db.QueryRow(`
-		UPDATE posts 
-		SET title = $1, content = $2 
-		WHERE id = $3 
-		RETURNING id, title, content, date_created, created_by
-	`, up.Title, up.Content, id).Scan(
-		&p.ID, &p.Title, &p.Content, &p.DateCreated, &p.CreatedBy,
-	)
+// GetSitemapPage returns one page of public posts, ordered by ID, as split
+// by GetSitemapPageDates. Pages are numbered from 0.
+func (db *DB) GetSitemapPage(ctx context.Context, page int, pageSize int) ([]models.PostModified, error) {
+	ctx, end := db.operation(ctx, "GetSitemapPage")
+	defer end()
 
-	if err == sql.ErrNoRows {
-		return models.Post{}, ErrNotFound
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.id, p.date_updated 
+		FROM posts p 
+		WHERE `+publicPostsFilter+` 
+		ORDER BY p.id 
+		LIMIT $1 OFFSET $2
+	`, pageSize, page*pageSize)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	if err != nil {
-		return models.Post{}, err
+	posts := []models.PostModified{}
+	for rows.Next() {
+		var p models.PostModified
+		if err := rows.Scan(&p.ID, &p.DateUpdated); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
 	}
 
-	return p, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetPost retrieves a single post by ID, as seen by viewerID
+func (db *DB) GetPost(ctx context.Context, id int, viewerID int) (models.Post, error) {
+	ctx, end := db.operation(ctx, "GetPost")
+	defer end()
+
+	return scanPost(db.QueryRowContext(ctx, `
+		SELECT `+postColumns+` 
+		FROM posts p `+postViewerJoins+` 
+		WHERE p.id = $2
+	`, viewerID, id))
+}
+
+// CreatePost adds a new post to the database
+func (db *DB) CreatePost(ctx context.Context, np models.NewPost) (models.Post, error) {
+	ctx, end := db.operation(ctx, "CreatePost")
+	defer end()
+
+	return scanPost(db.QueryRowContext(ctx, `
+		WITH p AS (
+			INSERT INTO posts (title, content, created_by) 
+			VALUES ($2, $3, $4) 
+			RETURNING *
+		) 
+		SELECT `+postColumns+` 
+		FROM p `+postViewerJoins,
+		0, np.Title, np.Content, np.CreatedBy,
+	))
+}
+
+// UpdatePost modifies an existing post, returning it as seen by viewerID
+func (db *DB) UpdatePost(ctx context.Context, id int, up models.UpdatePost, viewerID int) (models.Post, error) {
+	ctx, end := db.operation(ctx, "UpdatePost")
+	defer end()
+
+	return scanPost(db.QueryRowContext(ctx, `
+		WITH p AS (
+			UPDATE posts 
+			SET title = $2, content = $3, date_updated = NOW() 
+			WHERE id = $4 
+			RETURNING *
+		) 
+		SELECT `+postColumns+` 
+		FROM p `+postViewerJoins,
+		viewerID, up.Title, up.Content, id,
+	))
 }
 
 // DeletePost removes a post from the database
-func (db *DB) DeletePost(id int) error {
-	result, err := db.Exec(`DELETE FROM posts WHERE id = $1`, id)
+func (db *DB) DeletePost(ctx context.Context, id int) error {
+	ctx, end := db.operation(ctx, "DeletePost")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, id)
 	if err != nil {
 		return err
 	}
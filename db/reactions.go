@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"blog2/models"
+)
+
+var (
+	ErrInvalidReaction = errors.New("invalid reaction")
+)
+
+// reactionCountColumn returns the posts column counting a kind of reaction.
+// Only names from models.ReactionTypes reach SQL.
+func reactionCountColumn(reaction string) (string, error) {
+	if !models.IsReactionType(reaction) {
+		return "", ErrInvalidReaction
+	}
+	return reaction + "_count", nil
+}
+
+// lockPost locks a post row for the rest of tx, so that reaction changes to
+// it and its counters happen one at a time
+func lockPost(ctx context.Context, tx *sql.Tx, postID int) error {
+	var id int
+	err := tx.QueryRowContext(ctx, `SELECT id FROM posts WHERE id = $1 FOR UPDATE`, postID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// currentReaction returns the user's reaction to a post, or "" if none
+func currentReaction(ctx context.Context, tx *sql.Tx, userID int, postID int) (string, error) {
+	var reaction string
+	err := tx.QueryRowContext(ctx, `
+		SELECT reaction 
+		FROM post_reactions 
+		WHERE post_id = $1 AND user_id = $2
+	`, postID, userID).Scan(&reaction)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return reaction, err
+}
+
+// adjustReactionCount adds delta to the counter for a kind of reaction
+func adjustReactionCount(ctx context.Context, tx *sql.Tx, postID int, reaction string, delta int) error {
+	column, err := reactionCountColumn(reaction)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE posts SET %[1]s = %[1]s + $1 WHERE id = $2`, column), delta, postID)
+	return err
+}
+
+// SetReaction sets the user's reaction to a post, replacing any earlier one.
+// Setting the same reaction again has no effect.
+func (db *DB) SetReaction(ctx context.Context, userID int, postID int, reaction string) (models.Post, error) {
+	ctx, end := db.operation(ctx, "SetReaction")
+	defer end()
+
+	if !models.IsReactionType(reaction) {
+		return models.Post{}, ErrInvalidReaction
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Post{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockPost(ctx, tx, postID); err != nil {
+		return models.Post{}, err
+	}
+
+	previous, err := currentReaction(ctx, tx, userID, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	if previous != reaction {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO post_reactions (post_id, user_id, reaction) 
+			VALUES ($1, $2, $3) 
+			ON CONFLICT (post_id, user_id) DO UPDATE 
+			SET reaction = EXCLUDED.reaction, date_created = CURRENT_TIMESTAMP
+		`, postID, userID, reaction)
+		if err != nil {
+			return models.Post{}, err
+		}
+
+		if previous != "" {
+			if err := adjustReactionCount(ctx, tx, postID, previous, -1); err != nil {
+				return models.Post{}, err
+			}
+		}
+
+		if err := adjustReactionCount(ctx, tx, postID, reaction, 1); err != nil {
+			return models.Post{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Post{}, err
+	}
+
+	return db.GetPost(ctx, postID, userID)
+}
+
+// RemoveReaction removes the user's reaction to a post, if any
+func (db *DB) RemoveReaction(ctx context.Context, userID int, postID int) (models.Post, error) {
+	ctx, end := db.operation(ctx, "RemoveReaction")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Post{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockPost(ctx, tx, postID); err != nil {
+		return models.Post{}, err
+	}
+
+	previous, err := currentReaction(ctx, tx, userID, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	if previous != "" {
+		_, err = tx.ExecContext(ctx, `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2`, postID, userID)
+		if err != nil {
+			return models.Post{}, err
+		}
+
+		if err := adjustReactionCount(ctx, tx, postID, previous, -1); err != nil {
+			return models.Post{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Post{}, err
+	}
+
+	return db.GetPost(ctx, postID, userID)
+}
+
+// removeUserReactions takes every reaction of a user off the post counters.
+// It is called before deleting the user, whose reaction rows then go with
+// the cascade.
+func removeUserReactions(ctx context.Context, tx *sql.Tx, userID int) error {
+	var set []string
+	for _, reaction := range models.ReactionTypes {
+		column, err := reactionCountColumn(reaction)
+		if err != nil {
+			return err
+		}
+		set = append(set, fmt.Sprintf(`%[1]s = %[1]s - (r.reaction = '%[2]s')::int`, column, reaction))
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE posts p 
+		SET `+strings.Join(set, ", ")+` 
+		FROM post_reactions r 
+		WHERE r.post_id = p.id AND r.user_id = $1
+	`, userID)
+
+	return err
+}
+
+// AddBookmark saves a post to the user's bookmarks. Bookmarking a post
+// twice has no further effect.
+func (db *DB) AddBookmark(ctx context.Context, userID int, postID int) error {
+	ctx, end := db.operation(ctx, "AddBookmark")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO bookmarks (user_id, post_id) 
+		SELECT $1, id FROM posts WHERE id = $2 
+		ON CONFLICT (user_id, post_id) DO NOTHING
+	`, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Nothing inserted means either an existing bookmark or a missing post
+	if rowsAffected == 0 {
+		var exists bool
+		err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)`, postID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+// RemoveBookmark removes a post from the user's bookmarks, if it is there
+func (db *DB) RemoveBookmark(ctx context.Context, userID int, postID int) error {
+	ctx, end := db.operation(ctx, "RemoveBookmark")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`, userID, postID)
+	return err
+}
+
+// GetBookmarks returns up to limit of the user's bookmarks, most recently
+// saved first. Pass a zero before time for the first page, or the
+// BookmarkedAt and post ID of the last bookmark of the previous page.
+func (db *DB) GetBookmarks(ctx context.Context, userID int, before time.Time, beforeID int, limit int) ([]models.Bookmark, error) {
+	ctx, end := db.operation(ctx, "GetBookmarks")
+	defer end()
+
+	before, beforeID = keysetStart(before, beforeID)
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+postColumns+`, b.date_created 
+		FROM posts p `+postViewerJoins+` 
+		WHERE b.user_id = $1 AND (b.date_created, b.post_id) < ($2, $3) 
+		ORDER BY b.date_created DESC, b.post_id DESC 
+		LIMIT $4
+	`, userID, before, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []models.Bookmark{}
+	for rows.Next() {
+		var bookmarkedAt time.Time
+		p, err := scanPost(bookmarkScanner{rows, &bookmarkedAt})
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, models.Bookmark{Post: p, BookmarkedAt: bookmarkedAt})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+// bookmarkScanner reads the bookmark time selected after postColumns
+type bookmarkScanner struct {
+	rows         *sql.Rows
+	bookmarkedAt *time.Time
+}
+
+// Scan implements rowScanner
+func (s bookmarkScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.bookmarkedAt)...)
+}
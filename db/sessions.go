@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"blog2/auth"
+	"blog2/models"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// sessionSeenInterval limits how often last_seen_at is written for a session
+const sessionSeenInterval = time.Minute
+
+// sessionColumns lists the columns read into a models.Session by scanSession
+const sessionColumns = `id, user_agent, ip, date_created, last_seen_at, expires_at`
+
+// scanSession reads a session selected with sessionColumns
+func scanSession(row rowScanner) (models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID, &session.UserAgent, &session.IP, &session.DateCreated, &session.LastSeenAt, &session.ExpiresAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.Session{}, ErrSessionNotFound
+	}
+
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// CreateSession stores a new session for a user
+func (db *DB) CreateSession(ctx context.Context, id string, userID int, userAgent string, ip string, expiresAt time.Time) (models.Session, error) {
+	ctx, end := db.operation(ctx, "CreateSession")
+	defer end()
+
+	// Keep within the column size; user agents are free text from the client
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	return scanSession(db.QueryRowContext(ctx, `
+		INSERT INTO sessions (id, user_id, user_agent, ip, expires_at) 
+		VALUES ($1, $2, $3, $4, $5) 
+		RETURNING `+sessionColumns,
+		id, userID, userAgent, ip, expiresAt,
+	))
+}
+
+// GetSessionsByUser retrieves the active sessions of a user
+func (db *DB) GetSessionsByUser(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, end := db.operation(ctx, "GetSessionsByUser")
+	defer end()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+sessionColumns+` 
+		FROM sessions 
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW() 
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes one of a user's sessions
+func (db *DB) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	ctx, end := db.operation(ctx, "RevokeSession")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE sessions 
+		SET revoked_at = NOW() 
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of a user except keepSessionID,
+// which may be empty to revoke them all
+func (db *DB) RevokeOtherSessions(ctx context.Context, userID int, keepSessionID string) error {
+	ctx, end := db.operation(ctx, "RevokeOtherSessions")
+	defer end()
+
+	return revokeOtherSessions(ctx, db.DB, userID, keepSessionID)
+}
+
+// revokeOtherSessions runs RevokeOtherSessions on a database or transaction
+func revokeOtherSessions(ctx context.Context, exec interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}, userID int, keepSessionID string) error {
+	_, err := exec.ExecContext(ctx, `
+		UPDATE sessions 
+		SET revoked_at = NOW() 
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`, userID, keepSessionID)
+
+	return err
+}
+
+// TouchSession checks that a session is still active and records that it was
+// seen. It implements auth.CredentialStore.
+func (db *DB) TouchSession(ctx context.Context, sessionID string, userID int) error {
+	ctx, end := db.operation(ctx, "TouchSession")
+	defer end()
+
+	var lastSeenAt time.Time
+	err := db.QueryRowContext(ctx, `
+		SELECT last_seen_at 
+		FROM sessions 
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+	`, sessionID, userID).Scan(&lastSeenAt)
+
+	if err == sql.ErrNoRows {
+		return auth.ErrRevokedSession
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Only write last_seen_at once a minute to keep busy sessions cheap
+	if time.Since(lastSeenAt) < sessionSeenInterval {
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx, `UPDATE sessions SET last_seen_at = NOW() WHERE id = $1`, sessionID)
+	return err
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+	ErrTOTPCodeReused      = errors.New("two-factor code has already been used")
+	ErrTOTPSetupChanged    = errors.New("two-factor setup was confirmed or restarted")
+)
+
+// SetPendingTOTPSecret stores a TOTP secret that has not been confirmed yet
+func (db *DB) SetPendingTOTPSecret(ctx context.Context, userID int, secret string) error {
+	ctx, end := db.operation(ctx, "SetPendingTOTPSecret")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE users 
+		SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = NULL 
+		WHERE id = $2
+	`, secret, userID)
+
+	return err
+}
+
+// EnableTOTP confirms two-factor authentication for a user and replaces their
+// recovery codes with the given hashes. It returns ErrTOTPSetupChanged,
+// without touching the recovery codes, if secret is no longer the pending
+// secret because setup was confirmed or started again in the meantime.
+func (db *DB) EnableTOTP(ctx context.Context, userID int, secret string, step int64, recoveryCodeHashes []string) error {
+	ctx, end := db.operation(ctx, "EnableTOTP")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users 
+		SET totp_enabled_at = NOW(), totp_last_step = $1 
+		WHERE id = $2 AND totp_enabled_at IS NULL AND totp_secret = $3
+	`, step, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPSetupChanged
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO two_factor_recovery_codes (user_id, code_hash) 
+			VALUES ($1, $2)
+		`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication and removes recovery codes
+func (db *DB) DisableTOTP(ctx context.Context, userID int) error {
+	ctx, end := db.operation(ctx, "DisableTOTP")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users 
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL 
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code for the given time step was accepted. It
+// returns ErrTOTPCodeReused if that step or a later one was already used.
+func (db *DB) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	ctx, end := db.operation(ctx, "UseTOTPStep")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE users 
+		SET totp_last_step = $1 
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)
+	`, step, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+// UseRecoveryCode redeems one of a user's recovery codes. Checking used_at
+// again in the outer query makes concurrent redemptions of the same code wait
+// for each other, so that only the first one succeeds.
+func (db *DB) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	ctx, end := db.operation(ctx, "UseRecoveryCode")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE two_factor_recovery_codes 
+		SET used_at = NOW() 
+		WHERE id = (
+			SELECT id FROM two_factor_recovery_codes 
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL 
+			LIMIT 1
+		) AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidRecoveryCode
+	}
+
+	return nil
+}
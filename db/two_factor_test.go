@@ -0,0 +1,198 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/db/dbtest"
+	"blog2/models"
+)
+
+// enableTwoFactor creates a user with two-factor authentication enabled at
+// the given step and the given recovery codes
+func enableTwoFactor(t *testing.T, database *db.DB, step int64, recoveryCodes []string) models.User {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := database.CreateUser(ctx, models.NewUser{Username: "johndoe", Email: "john@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetPendingTOTPSecret(ctx, user.ID, secret); err != nil {
+		t.Fatalf("SetPendingTOTPSecret: %v", err)
+	}
+
+	hashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		hashes[i] = auth.HashToken(code)
+	}
+	if err := database.EnableTOTP(ctx, user.ID, secret, step, hashes); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+
+	return user
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	// Confirming setup uses up the step of the confirmation code
+	user := enableTwoFactor(t, database, 100, nil)
+
+	tests := []struct {
+		name    string
+		step    int64
+		wantErr error
+	}{
+		{"confirmation code replayed", 100, db.ErrTOTPCodeReused},
+		{"earlier step", 99, db.ErrTOTPCodeReused},
+		{"next step", 101, nil},
+		{"next step replayed", 101, db.ErrTOTPCodeReused},
+		{"code from before the last one", 100, db.ErrTOTPCodeReused},
+		{"later step", 103, nil},
+	}
+
+	for _, tt := range tests {
+		if err := database.UseTOTPStep(ctx, user.ID, tt.step); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: UseTOTPStep(%d) = %v, want %v", tt.name, tt.step, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	user := enableTwoFactor(t, database, 100, []string{"abcde-fghij", "klmno-pqrst"})
+
+	tests := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{"unused code", "abcde-fghij", nil},
+		{"reused code", "abcde-fghij", db.ErrInvalidRecoveryCode},
+		{"unknown code", "zzzzz-zzzzz", db.ErrInvalidRecoveryCode},
+		{"other unused code", "klmno-pqrst", nil},
+		{"other code reused", "klmno-pqrst", db.ErrInvalidRecoveryCode},
+	}
+
+	for _, tt := range tests {
+		if err := database.UseRecoveryCode(ctx, user.ID, auth.HashToken(tt.code)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: UseRecoveryCode = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUseRecoveryCodeOtherUser(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	enableTwoFactor(t, database, 100, []string{"abcde-fghij"})
+
+	other, err := database.CreateUser(ctx, models.NewUser{Username: "janedoe", Email: "jane@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := database.UseRecoveryCode(ctx, other.ID, auth.HashToken("abcde-fghij")); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+		t.Errorf("UseRecoveryCode with another user's code = %v, want %v", err, db.ErrInvalidRecoveryCode)
+	}
+}
+
+func TestUseRecoveryCodeConcurrently(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	codes := make([]string, 10)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("code%d-abcde", i)
+	}
+	user := enableTwoFactor(t, database, 100, codes)
+
+	// Redeem each code twice at the same time; exactly one must succeed
+	for _, code := range codes {
+		var (
+			start sync.WaitGroup
+			done  sync.WaitGroup
+			errs  [2]error
+		)
+		start.Add(1)
+		for i := range errs {
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				start.Wait()
+				errs[i] = database.UseRecoveryCode(ctx, user.ID, auth.HashToken(code))
+			}()
+		}
+		start.Done()
+		done.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, db.ErrInvalidRecoveryCode):
+				t.Fatalf("UseRecoveryCode(%s) = %v", code, err)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("code %s was redeemed %d times, want 1", code, succeeded)
+		}
+	}
+}
+
+func TestEnableTOTPSetupChanged(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	user, err := database.CreateUser(ctx, models.NewUser{Username: "johndoe", Email: "john@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	// Setup restarted with a new secret before the first one was confirmed
+	if err := database.SetPendingTOTPSecret(ctx, user.ID, "FIRSTSECRET"); err != nil {
+		t.Fatalf("SetPendingTOTPSecret: %v", err)
+	}
+	if err := database.SetPendingTOTPSecret(ctx, user.ID, "SECONDSECRET"); err != nil {
+		t.Fatalf("SetPendingTOTPSecret: %v", err)
+	}
+	err = database.EnableTOTP(ctx, user.ID, "FIRSTSECRET", 100, []string{auth.HashToken("stale-codes")})
+	if !errors.Is(err, db.ErrTOTPSetupChanged) {
+		t.Fatalf("EnableTOTP with a replaced secret = %v, want %v", err, db.ErrTOTPSetupChanged)
+	}
+
+	if err := database.EnableTOTP(ctx, user.ID, "SECONDSECRET", 100, []string{auth.HashToken("first-codes")}); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+
+	// Confirming again must not replace the recovery codes already handed out
+	err = database.EnableTOTP(ctx, user.ID, "SECONDSECRET", 101, []string{auth.HashToken("second-codes")})
+	if !errors.Is(err, db.ErrTOTPSetupChanged) {
+		t.Fatalf("EnableTOTP when already enabled = %v, want %v", err, db.ErrTOTPSetupChanged)
+	}
+
+	if err := database.UseRecoveryCode(ctx, user.ID, auth.HashToken("second-codes")); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+		t.Errorf("recovery code from the second confirmation: UseRecoveryCode = %v, want %v", err, db.ErrInvalidRecoveryCode)
+	}
+	if err := database.UseRecoveryCode(ctx, user.ID, auth.HashToken("stale-codes")); !errors.Is(err, db.ErrInvalidRecoveryCode) {
+		t.Errorf("recovery code from the replaced setup: UseRecoveryCode = %v, want %v", err, db.ErrInvalidRecoveryCode)
+	}
+	if err := database.UseRecoveryCode(ctx, user.ID, auth.HashToken("first-codes")); err != nil {
+		t.Errorf("recovery code from the first confirmation: UseRecoveryCode = %v", err)
+	}
+}
@@ -1,25 +1,112 @@
 package db
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
+	"log/slog"
 	"time"
 
+	"blog2/auth"
 	"blog2/models"
-	"golang.org/x/crypto/bcrypt"
+	"blog2/password"
 )
 
 var (
-	ErrUserNotFound       = errors.New("user not found")
-	ErrUserAlreadyExists  = errors.New("username or email already exists")
-	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUserAlreadyExists     = errors.New("username or email already exists")
+	ErrInvalidCredentials    = errors.New("invalid username or password")
+	ErrVerificationThrottled = errors.New("verification email sent too recently")
 )
 
+// compareDummyPassword spends the same time as checking a real password. It
+// is used when a login names an unknown user, so that the response takes as
+// long as it would for a wrong password.
+func (db *DB) compareDummyPassword(plaintext string) {
+	db.dummyHashOnce.Do(func() {
+		db.dummyHash, _ = db.Hasher.Hash("dummy-password")
+	})
+	db.Hasher.Verify(db.dummyHash, plaintext)
+}
+
+// verifyPassword checks plaintext against a user's stored hash. Hashes made
+// with outdated parameters are upgraded to the current ones on success.
+func (db *DB) verifyPassword(ctx context.Context, user *models.User, plaintext string) error {
+	ok, err := db.Hasher.Verify(user.PasswordHash, plaintext)
+	if err != nil && !errors.Is(err, password.ErrUnsupportedHash) {
+		return err
+	}
+
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	if !db.Hasher.NeedsRehash(user.PasswordHash) {
+		return nil
+	}
+
+	// A failed upgrade leaves the old hash working, so don't fail the login
+	hash, err := db.Hasher.Hash(plaintext)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error rehashing password", "user", user.ID, "err", err)
+		return nil
+	}
+
+	// Only replace the hash that was verified, in case the password changed
+	_, err = db.ExecContext(ctx, `
+		UPDATE users 
+		SET password_hash = $1 
+		WHERE id = $2 AND password_hash = $3
+	`, hash, user.ID, user.PasswordHash)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error rehashing password", "user", user.ID, "err", err)
+		return nil
+	}
+
+	user.PasswordHash = hash
+	return nil
+}
+
+// userColumns lists the columns read into a models.User by scanUser
+const userColumns = `id, username, email, password_hash, date_created, last_login, email_verified_at,
+	COALESCE(totp_secret, ''), totp_enabled_at IS NOT NULL,
+	display_name, bio, avatar_url, website, profile_private, role`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads a user selected with userColumns
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.DateCreated, &user.LastLogin,
+		&user.EmailVerifiedAt, &user.TOTPSecret, &user.TwoFactorEnabled,
+		&user.DisplayName, &user.Bio, &user.AvatarURL, &user.Website, &user.ProfilePrivate,
+		&user.Role,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.User{}, ErrUserNotFound
+	}
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
 // CreateUser adds a new user to the database
-func (db *DB) CreateUser(nu models.NewUser) (models.User, error) {
+func (db *DB) CreateUser(ctx context.Context, nu models.NewUser) (models.User, error) {
+	ctx, end := db.operation(ctx, "CreateUser")
+	defer end()
+
 	// Check if username or email already exists
 	var exists bool
-	err := db.QueryRow(`
+	err := db.QueryRowContext(ctx, `
 		SELECT EXISTS (
 			SELECT 1 FROM users WHERE username = $1 OR email = $2
 		)
@@ -34,38 +121,214 @@ func (db *DB) CreateUser(nu models.NewUser) (models.User, error) {
 	}
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
+	hashedPassword, err := db.Hasher.Hash(nu.Password)
 	if err != nil {
 		return models.User{}, err
 	}
 
 	// Insert the new user
-	var user models.User
-	err = db.QueryRow(`
+	return scanUser(db.QueryRowContext(ctx, `
 		INSERT INTO users (username, email, password_hash) 
 		VALUES ($1, $2, $3) 
-		RETURNING id, username, email, password_hash, date_created, last_login
-	`, nu.Username, nu.Email, string(hashedPassword)).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.DateCreated, &user.LastLogin,
-	)
+		RETURNING `+userColumns,
+		nu.Username, nu.Email, hashedPassword,
+	))
+}
+
+// GetUserByUsername retrieves a user by username
+func (db *DB) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	ctx, end := db.operation(ctx, "GetUserByUsername")
+	defer end()
+
+	return scanUser(db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` 
+		FROM users 
+		WHERE username = $1
+	`, username))
+}
+
+// GetUserByEmail retrieves a user by email address
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, end := db.operation(ctx, "GetUserByEmail")
+	defer end()
+
+	return scanUser(db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` 
+		FROM users 
+		WHERE email = $1
+	`, email))
+}
+
+// GetUserByID retrieves a user by ID
+func (db *DB) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, end := db.operation(ctx, "GetUserByID")
+	defer end()
+
+	return scanUser(db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` 
+		FROM users 
+		WHERE id = $1
+	`, id))
+}
 
+// UpdateLastLogin updates the last_login timestamp for a user
+func (db *DB) UpdateLastLogin(ctx context.Context, userID int) error {
+	ctx, end := db.operation(ctx, "UpdateLastLogin")
+	defer end()
+
+	now := time.Now()
+	_, err := db.ExecContext(ctx, `
+		UPDATE users 
+		SET last_login = $1 
+		WHERE id = $2
+	`, now, userID)
+
+	return err
+}
+
+// MarkEmailVerified records that a user has verified the given email address.
+// It returns ErrUserNotFound if the user's email no longer matches.
+func (db *DB) MarkEmailVerified(ctx context.Context, userID int, email string) (models.User, error) {
+	ctx, end := db.operation(ctx, "MarkEmailVerified")
+	defer end()
+
+	return scanUser(db.QueryRowContext(ctx, `
+		UPDATE users 
+		SET email_verified_at = COALESCE(email_verified_at, NOW()) 
+		WHERE id = $1 AND email = $2 
+		RETURNING `+userColumns,
+		userID, email,
+	))
+}
+
+// ClaimVerificationSend records that a verification email is about to be sent.
+// It returns ErrVerificationThrottled if one was sent within the interval.
+func (db *DB) ClaimVerificationSend(ctx context.Context, userID int, interval time.Duration) error {
+	ctx, end := db.operation(ctx, "ClaimVerificationSend")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE users 
+		SET email_verification_sent_at = NOW() 
+		WHERE id = $1 
+		AND (email_verification_sent_at IS NULL OR email_verification_sent_at < NOW() - $2 * INTERVAL '1 second')
+	`, userID, interval.Seconds())
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrVerificationThrottled
+	}
+
+	return nil
+}
+
+// CheckPassword verifies the password of the user with the given ID
+func (db *DB) CheckPassword(ctx context.Context, userID int, plaintext string) (models.User, error) {
+	ctx, end := db.operation(ctx, "CheckPassword")
+	defer end()
+
+	user, err := db.GetUserByID(ctx, userID)
 	if err != nil {
 		return models.User{}, err
 	}
 
+	if err := db.verifyPassword(ctx, &user, plaintext); err != nil {
+		return models.User{}, err
+	}
+
 	return user, nil
 }
 
-// GetUserByUsername retrieves a user by username
-func (db *DB) GetUserByUsername(username string) (models.User, error) {
-	var user models.User
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, date_created, last_login 
+// ChangePassword replaces a user's password after checking the current one.
+// Every session of the user except keepSessionID is revoked.
+func (db *DB) ChangePassword(ctx context.Context, userID int, currentPassword string, newPassword string, keepSessionID string) error {
+	ctx, end := db.operation(ctx, "ChangePassword")
+	defer end()
+
+	if _, err := db.CheckPassword(ctx, userID, currentPassword); err != nil {
+		return err
+	}
+
+	// Hash the new password
+	hashedPassword, err := db.Hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users 
+		SET password_hash = $1 
+		WHERE id = $2
+	`, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := revokeOtherSessions(ctx, tx, userID, keepSessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// EmailInUse reports whether any user other than userID has the given email
+func (db *DB) EmailInUse(ctx context.Context, email string, userID int) (bool, error) {
+	ctx, end := db.operation(ctx, "EmailInUse")
+	defer end()
+
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE email = $1 AND id <> $2
+		)
+	`, email, userID).Scan(&exists)
+
+	return exists, err
+}
+
+// ChangeEmail sets a new, already verified email address for a user. The
+// change was requested while the user had previousEmail and a password
+// matching passwordStamp; if either has changed since, it returns
+// ErrUserNotFound so that a password reset cancels pending changes.
+func (db *DB) ChangeEmail(ctx context.Context, userID int, previousEmail string, passwordStamp string, email string) (models.User, error) {
+	ctx, end := db.operation(ctx, "ChangeEmail")
+	defer end()
+
+	exists, err := db.EmailInUse(ctx, email, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if exists {
+		return models.User{}, ErrUserAlreadyExists
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	var passwordHash string
+	err = tx.QueryRowContext(ctx, `
+		SELECT password_hash 
 		FROM users 
-		WHERE username = $1
-	`, username).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.DateCreated, &user.LastLogin,
-	)
+		WHERE id = $1 AND email = $2 
+		FOR UPDATE
+	`, userID, previousEmail).Scan(&passwordHash)
 
 	if err == sql.ErrNoRows {
 		return models.User{}, ErrUserNotFound
@@ -75,20 +338,109 @@ func (db *DB) GetUserByUsername(username string) (models.User, error) {
 		return models.User{}, err
 	}
 
-	return user, nil
+	if subtle.ConstantTimeCompare([]byte(auth.PasswordStamp(passwordHash)), []byte(passwordStamp)) != 1 {
+		return models.User{}, ErrUserNotFound
+	}
+
+	user, err := scanUser(tx.QueryRowContext(ctx, `
+		UPDATE users 
+		SET email = $1, email_verified_at = NOW() 
+		WHERE id = $2 
+		RETURNING `+userColumns,
+		email, userID,
+	))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, tx.Commit()
 }
 
-// GetUserByID retrieves a user by ID
-func (db *DB) GetUserByID(id int) (models.User, error) {
-	var user models.User
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, date_created, last_login 
-		FROM users 
-		WHERE id = $1
-	`, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.DateCreated, &user.LastLogin,
-	)
+// SetPassword replaces a user's password without checking the current one
+// and logs them out everywhere, for administrators resetting an account
+func (db *DB) SetPassword(ctx context.Context, userID int, newPassword string) error {
+	ctx, end := db.operation(ctx, "SetPassword")
+	defer end()
+
+	hashedPassword, err := db.Hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users 
+		SET password_hash = $1 
+		WHERE id = $2
+	`, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := revokeOtherSessions(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetRole changes the role of a user
+func (db *DB) SetRole(ctx context.Context, userID int, role string) (models.User, error) {
+	ctx, end := db.operation(ctx, "SetRole")
+	defer end()
+
+	return scanUser(db.QueryRowContext(ctx, `
+		UPDATE users 
+		SET role = $1 
+		WHERE id = $2 
+		RETURNING `+userColumns,
+		role, userID,
+	))
+}
+
+// UpdateUsername renames a user and moves their posts to the new name
+func (db *DB) UpdateUsername(ctx context.Context, userID int, username string) (models.User, error) {
+	ctx, end := db.operation(ctx, "UpdateUsername")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE username = $1 AND id <> $2
+		)
+	`, username, userID).Scan(&exists)
+
+	if err != nil {
+		return models.User{}, err
+	}
 
+	if exists {
+		return models.User{}, ErrUserAlreadyExists
+	}
+
+	// Read the current name so posts can be moved across
+	var oldUsername string
+	err = tx.QueryRowContext(ctx, `SELECT username FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&oldUsername)
 	if err == sql.ErrNoRows {
 		return models.User{}, ErrUserNotFound
 	}
@@ -97,39 +449,104 @@ func (db *DB) GetUserByID(id int) (models.User, error) {
 		return models.User{}, err
 	}
 
+	user, err := scanUser(tx.QueryRowContext(ctx, `
+		UPDATE users 
+		SET username = $1 
+		WHERE id = $2 
+		RETURNING `+userColumns,
+		username, userID,
+	))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE posts SET created_by = $1 WHERE created_by = $2`, username, oldUsername)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, err
+	}
+
 	return user, nil
 }
 
-// UpdateLastLogin updates the last_login timestamp for a user
-func (db *DB) UpdateLastLogin(userID int) error {
-	now := time.Now()
-	_, err := db.Exec(`
+// UpdateProfile changes the profile fields of a user. Nil fields in update
+// are left unchanged; the username is changed separately by UpdateUsername.
+func (db *DB) UpdateProfile(ctx context.Context, userID int, update models.UpdateUserRequest) (models.User, error) {
+	ctx, end := db.operation(ctx, "UpdateProfile")
+	defer end()
+
+	return scanUser(db.QueryRowContext(ctx, `
 		UPDATE users 
-		SET last_login = $1 
-		WHERE id = $2
-	`, now, userID)
+		SET display_name = COALESCE($1, display_name), 
+			bio = COALESCE($2, bio), 
+			avatar_url = COALESCE($3, avatar_url), 
+			website = COALESCE($4, website), 
+			profile_private = COALESCE($5, profile_private) 
+		WHERE id = $6 
+		RETURNING `+userColumns,
+		update.DisplayName, update.Bio, update.AvatarURL, update.Website, update.ProfilePrivate, userID,
+	))
+}
 
-	return err
+// DeleteUser removes a user account and hands their posts to reassignTo
+func (db *DB) DeleteUser(ctx context.Context, userID int, reassignTo string) error {
+	ctx, end := db.operation(ctx, "DeleteUser")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Keep the reaction counters right once the user's reactions are gone
+	if err := removeUserReactions(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	var username string
+	err = tx.QueryRowContext(ctx, `DELETE FROM users WHERE id = $1 RETURNING username`, userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE posts SET created_by = $1 WHERE created_by = $2`, reassignTo, username)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // AuthenticateUser checks if the provided credentials are valid
-func (db *DB) AuthenticateUser(login models.LoginRequest) (models.User, error) {
-	user, err := db.GetUserByUsername(login.Username)
+func (db *DB) AuthenticateUser(ctx context.Context, login models.LoginRequest) (models.User, error) {
+	ctx, end := db.operation(ctx, "AuthenticateUser")
+	defer end()
+
+	user, err := db.GetUserByUsername(ctx, login.Username)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
+			db.compareDummyPassword(login.Password)
 			return models.User{}, ErrInvalidCredentials
 		}
 		return models.User{}, err
 	}
 
-	// Compare the provided password with the stored hash
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(login.Password))
-	if err != nil {
-		return models.User{}, ErrInvalidCredentials
+	// Compare the provided password with the stored hash, upgrading it if
+	// it was made with outdated parameters
+	if err := db.verifyPassword(ctx, &user, login.Password); err != nil {
+		return models.User{}, err
 	}
 
 	// Update last login time
-	err = db.UpdateLastLogin(user.ID)
+	err = db.UpdateLastLogin(ctx, user.ID)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -0,0 +1,92 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"blog2/db"
+	"blog2/db/dbtest"
+	"blog2/models"
+	"blog2/password"
+)
+
+// newHasher returns a cheap hasher for tests
+func newHasher(t *testing.T, algorithm password.Algorithm) *password.Hasher {
+	t.Helper()
+
+	hasher, err := password.NewHasher(password.HashConfig{
+		Algorithm:  algorithm,
+		BcryptCost: 4,
+		Argon2:     password.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return hasher
+}
+
+func TestLoginRehashesOutdatedPassword(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	// Create the user while bcrypt is configured, then switch to Argon2id
+	database.Hasher = newHasher(t, password.Bcrypt)
+	user, err := database.CreateUser(ctx, models.NewUser{Username: "johndoe", Email: "john@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if !strings.HasPrefix(user.PasswordHash, "$2a$") {
+		t.Fatalf("password hash %q is not bcrypt", user.PasswordHash)
+	}
+	database.Hasher = newHasher(t, password.Argon2id)
+
+	// A failed login leaves the hash alone
+	_, err = database.AuthenticateUser(ctx, models.LoginRequest{Username: "johndoe", Password: "wrong password"})
+	if !errors.Is(err, db.ErrInvalidCredentials) {
+		t.Fatalf("AuthenticateUser with a wrong password = %v, want %v", err, db.ErrInvalidCredentials)
+	}
+	if stored := storedHash(t, database, user.ID); stored != user.PasswordHash {
+		t.Errorf("hash changed after a failed login: %q", stored)
+	}
+
+	if _, err := database.AuthenticateUser(ctx, models.LoginRequest{Username: "johndoe", Password: "correct horse battery"}); err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+
+	rehashed := storedHash(t, database, user.ID)
+	if !strings.HasPrefix(rehashed, "$argon2id$") {
+		t.Fatalf("hash after login = %q, want an Argon2id hash", rehashed)
+	}
+	if database.Hasher.NeedsRehash(rehashed) {
+		t.Error("new hash does not use the current settings")
+	}
+
+	// The new hash still accepts the password, and only that password
+	if _, err := database.CheckPassword(ctx, user.ID, "correct horse battery"); err != nil {
+		t.Errorf("CheckPassword after rehash: %v", err)
+	}
+	if _, err := database.CheckPassword(ctx, user.ID, "wrong password"); !errors.Is(err, db.ErrInvalidCredentials) {
+		t.Errorf("CheckPassword with a wrong password after rehash = %v, want %v", err, db.ErrInvalidCredentials)
+	}
+
+	// Logging in again does not hash the password again
+	if _, err := database.AuthenticateUser(ctx, models.LoginRequest{Username: "johndoe", Password: "correct horse battery"}); err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+	if stored := storedHash(t, database, user.ID); stored != rehashed {
+		t.Error("hash changed on a login that needed no rehash")
+	}
+}
+
+// storedHash reads a user's password hash from the database
+func storedHash(t *testing.T, database *db.DB, userID int) string {
+	t.Helper()
+
+	user, err := database.GetUserByID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	return user.PasswordHash
+}
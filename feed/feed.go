@@ -0,0 +1,40 @@
+// Package feed renders lists of posts as RSS 2.0, Atom 1.0 and JSON Feed 1.1
+// documents.
+package feed
+
+import (
+	"time"
+)
+
+// Feed is a format-independent description of a feed
+type Feed struct {
+	Title       string
+	Description string
+	Link        string // Page the feed is about
+	FeedURL     string // URL the feed itself is served from
+	Updated     time.Time
+	Items       []Item
+}
+
+// Item is one entry in a feed
+type Item struct {
+	ID        string // Stable, unique identifier; usually the permalink
+	Title     string
+	Link      string
+	Content   string // Plain text
+	Author    string
+	Published time.Time
+	Updated   time.Time
+}
+
+// LatestUpdate returns the most recent Updated time of the items, or the zero
+// time if there are none
+func LatestUpdate(items []Item) time.Time {
+	var latest time.Time
+	for _, item := range items {
+		if item.Updated.After(latest) {
+			latest = item.Updated
+		}
+	}
+	return latest
+}
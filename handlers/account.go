@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/mail"
+	"blog2/models"
+	"blog2/password"
+)
+
+// updateCurrentUser changes the username and profile fields of the current user
+func (h *UsersHandler) updateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	var updateRequest models.UpdateUserRequest
+	if !decodeJSON(w, r, &updateRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(updateRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
+	if err == nil && updateRequest.Username != nil && *updateRequest.Username != user.Username {
+		user, err = h.DB.UpdateUsername(r.Context(), claims.UserID, *updateRequest.Username)
+	}
+	if err == nil {
+		user, err = h.DB.UpdateProfile(r.Context(), claims.UserID, updateRequest)
+	}
+
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			writeProblem(w, r, http.StatusNotFound, "user_not_found", "User not found")
+		} else if errors.Is(err, db.ErrUserAlreadyExists) {
+			writeProblem(w, r, http.StatusConflict, "username_taken", "Username already exists")
+		} else {
+			writeError(w, r, fmt.Errorf("updating user: %w", err))
+		}
+		return
+	}
+
+	// The username is part of the token, so issue a fresh one for the
+	// same session. API key requests have no session and get a new one.
+	if claims.SessionID == "" {
+		h.writeLoginResponse(w, r, user, http.StatusOK)
+		return
+	}
+	h.writeSessionToken(w, r, user, claims.SessionID, http.StatusOK)
+}
+
+// changePassword sets a new password after checking the current one
+func (h *UsersHandler) changePassword(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	var changeRequest models.ChangePasswordRequest
+	if !decodeJSON(w, r, &changeRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(changeRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("changing password: %w", err))
+		return
+	}
+
+	// Check the new password against the password policy
+	candidate := password.Candidate{
+		Password: changeRequest.NewPassword,
+		Username: user.Username,
+		Email:    user.Email,
+	}
+	if !h.checkPasswordPolicy(w, r, "new_password", candidate) {
+		return
+	}
+
+	err = h.DB.ChangePassword(r.Context(), claims.UserID, changeRequest.CurrentPassword, changeRequest.NewPassword, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			writeProblem(w, r, http.StatusForbidden, "incorrect_password", "Current password is incorrect")
+		} else {
+			writeError(w, r, fmt.Errorf("changing password: %w", err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.MessageResponse{Message: "Password has been changed"})
+}
+
+// changeEmail sends a verification link to a new email address. The address
+// is only switched once the link is followed.
+func (h *UsersHandler) changeEmail(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	var changeRequest models.ChangeEmailRequest
+	if !decodeJSON(w, r, &changeRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(changeRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.DB.CheckPassword(r.Context(), claims.UserID, changeRequest.Password)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			writeProblem(w, r, http.StatusForbidden, "incorrect_password", "Password is incorrect")
+		} else {
+			writeError(w, r, fmt.Errorf("changing email: %w", err))
+		}
+		return
+	}
+
+	if changeRequest.Email == user.Email {
+		writeProblem(w, r, http.StatusBadRequest, "email_unchanged", "New email is the same as the current email")
+		return
+	}
+
+	inUse, err := h.DB.EmailInUse(r.Context(), changeRequest.Email, user.ID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("changing email: %w", err))
+		return
+	}
+
+	if inUse {
+		writeProblem(w, r, http.StatusConflict, "email_in_use", "Email is already in use by another account")
+		return
+	}
+
+	if err := h.mailVerificationLink(user, changeRequest.Email, auth.PurposeEmailChange); err != nil {
+		writeError(w, r, fmt.Errorf("sending verification email: %w", err))
+		return
+	}
+
+	// Let the current address know, in case the change was not made by its owner
+	go h.notifyEmailChange(context.WithoutCancel(r.Context()), user, changeRequest.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(models.MessageResponse{Message: "Verification email sent to the new address"})
+}
+
+// notifyEmailChange tells the user's current address that a change was requested
+func (h *UsersHandler) notifyEmailChange(ctx context.Context, user models.User, newEmail string) {
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Email change requested",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA request was made to change the email address on your account to %s. "+
+				"If this was not you, please reset your password.\n",
+			user.Username, newEmail,
+		),
+	}
+
+	if err := h.Mailer.Send(msg); err != nil {
+		slog.ErrorContext(ctx, "Error sending email change notice", "err", err)
+	}
+}
+
+// deleteCurrentUser deletes the current user's account after checking their
+// password. Their posts are kept according to the configured policy.
+func (h *UsersHandler) deleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	var deleteRequest models.DeleteAccountRequest
+	if !decodeJSON(w, r, &deleteRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(deleteRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	if _, err := h.DB.CheckPassword(r.Context(), claims.UserID, deleteRequest.Password); err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			writeProblem(w, r, http.StatusForbidden, "incorrect_password", "Password is incorrect")
+		} else {
+			writeError(w, r, fmt.Errorf("deleting account: %w", err))
+		}
+		return
+	}
+
+	if err := h.DB.DeleteUser(r.Context(), claims.UserID, h.deletedPostsAuthor()); err != nil {
+		writeError(w, r, fmt.Errorf("deleting account: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletedPostsAuthor returns the author that a deleted user's posts are attributed to
+func (h *UsersHandler) deletedPostsAuthor() string {
+	if h.AccountConfig.DeletedPostsPolicy == PostsReassign && h.AccountConfig.PostsReassignTo != "" {
+		return h.AccountConfig.PostsReassignTo
+	}
+	return AnonymousAuthor
+}
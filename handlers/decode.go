@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"blog2/apierror"
+)
+
+// maxBodyBytes is the largest request body accepted, comfortably above the
+// longest post anyone writes by hand
+const maxBodyBytes = 1 << 20
+
+// errTrailingData is returned for bodies with more than one JSON value
+var errTrailingData = errors.New("request body must contain a single JSON object")
+
+// decodeJSON reads a JSON object from the request body into dst. Bodies that
+// are too large get a 413 response; bodies that aren't a single JSON object
+// matching dst, including ones with fields dst doesn't have, get a 400. It
+// returns false if it wrote a response.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil {
+		// Anything after the object, even another object, is a mistake
+		if _, trailing := decoder.Token(); trailing == io.EOF {
+			return true
+		}
+		err = errTrailingData
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge,
+			fmt.Sprintf("Request body must not be larger than %d bytes", tooLarge.Limit))
+
+	case errors.Is(err, io.EOF):
+		writeProblem(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, "Request body is empty")
+
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		writeProblem(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, "Request body is not valid JSON")
+
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "Request body has a field of the wrong type").
+			WithFields([]apierror.FieldError{{Field: typeErr.Field, Code: "type", Message: "must be " + jsonKind(typeErr.Type.Kind().String())}}))
+
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeUnknownField, "Request body has a field that is not allowed").
+			WithFields([]apierror.FieldError{{Field: field, Code: "unknown", Message: "is not a known field"}}))
+
+	case errors.Is(err, errTrailingData):
+		writeProblem(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, "Request body must contain a single JSON object")
+
+	default:
+		writeProblem(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, "Request body must be a JSON object")
+	}
+
+	return false
+}
+
+// jsonKind names the JSON type that decodes into a Go kind
+func jsonKind(kind string) string {
+	switch kind {
+	case "string":
+		return "a string"
+	case "bool":
+		return "true or false"
+	case "slice", "array":
+		return "an array"
+	case "map", "struct":
+		return "an object"
+	case "ptr":
+		return "a value"
+	default:
+		return "a number"
+	}
+}
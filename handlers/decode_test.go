@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blog2/apierror"
+	"blog2/models"
+)
+
+// jsonOfSize returns a post whose JSON encoding is exactly size bytes long
+func jsonOfSize(size int) string {
+	const empty = `{"title":"","content":"x","created_by":"alice"}`
+	return `{"title":"` + strings.Repeat("a", size-len(empty)) + `","content":"x","created_by":"alice"}`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int // 0 if the body should decode
+		wantCode   string
+		wantField  string
+	}{
+		{"valid", `{"title":"Hello","content":"World","created_by":"alice"}`, 0, "", ""},
+		{"trailing whitespace", "{\"title\":\"Hello\"}\n\t ", 0, "", ""},
+		{"exactly the size limit", jsonOfSize(maxBodyBytes), 0, "", ""},
+		{"over the size limit", jsonOfSize(maxBodyBytes + 1), http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge, ""},
+		{"empty", "", http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+		{"invalid JSON", `{"title":`, http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+		{"syntax error", `{"title" "Hello"}`, http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+		{"array", `[{"title":"Hello"}]`, http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+		{"string", `"Hello"`, http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+		{"unknown field", `{"title":"Hello","author":"alice"}`, http.StatusBadRequest, apierror.CodeUnknownField, "author"},
+		{"wrong type", `{"title":42}`, http.StatusBadRequest, apierror.CodeInvalidBody, "title"},
+		{"second object", `{"title":"Hello"}{"title":"World"}`, http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+		{"trailing garbage", `{"title":"Hello"} x`, http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+		{"trailing value", `{"title":"Hello"} null`, http.StatusBadRequest, apierror.CodeInvalidBody, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(tt.body))
+
+			var post models.NewPost
+			ok := decodeJSON(rec, r, &post)
+
+			if tt.wantStatus == 0 {
+				if !ok {
+					t.Fatalf("decodeJSON failed with %d: %s", rec.Code, rec.Body)
+				}
+				if rec.Body.Len() != 0 {
+					t.Errorf("decodeJSON wrote a response: %s", rec.Body)
+				}
+				return
+			}
+
+			if ok {
+				t.Fatal("decodeJSON accepted the body")
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			var problem apierror.Problem
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			if problem.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", problem.Code, tt.wantCode)
+			}
+
+			var field string
+			if len(problem.Errors) > 0 {
+				field = problem.Errors[0].Field
+			}
+			if field != tt.wantField {
+				t.Errorf("field = %q, want %q", field, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestCreatePostBodyErrors(t *testing.T) {
+	// Bodies that can't be decoded are 400s; bodies that decode but fail
+	// validation are 422s. None of these reach the database.
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"not JSON", `title=Hello`, http.StatusBadRequest, apierror.CodeInvalidBody},
+		{"unknown field", `{"title":"Hello","content":"World","created_by":"alice","id":7}`, http.StatusBadRequest, apierror.CodeUnknownField},
+		{"wrong type", `{"title":"Hello","content":["World"],"created_by":"alice"}`, http.StatusBadRequest, apierror.CodeInvalidBody},
+		{"missing title", `{"content":"World","created_by":"alice"}`, http.StatusUnprocessableEntity, apierror.CodeValidationFailed},
+		{"title too long", `{"title":"` + strings.Repeat("a", 256) + `","content":"World","created_by":"alice"}`, http.StatusUnprocessableEntity, apierror.CodeValidationFailed},
+		{"empty object", `{}`, http.StatusUnprocessableEntity, apierror.CodeValidationFailed},
+	}
+
+	h := NewPostsHandler(nil, PostsConfig{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.createPost(rec, httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(tt.body)))
+
+			assertProblem(t, rec, tt.wantStatus, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"blog2/apierror"
+	"blog2/db"
+)
+
+// errorResponse is the response sent for an error from the db package
+type errorResponse struct {
+	err    error
+	status int
+	code   string
+	detail string
+}
+
+// errorResponses maps errors returned by the db package to responses.
+// Handlers that need a different response for one of these errors, such as
+// hiding whether a user exists, check for it before calling writeError.
+var errorResponses = []errorResponse{
+	{db.ErrNotFound, http.StatusNotFound, "post_not_found", "Post not found"},
+	{db.ErrUserNotFound, http.StatusNotFound, "user_not_found", "User not found"},
+	{db.ErrUserAlreadyExists, http.StatusConflict, "user_exists", "Username or email already exists"},
+	{db.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials", "Invalid username or password"},
+	{db.ErrVerificationThrottled, http.StatusTooManyRequests, "verification_throttled", "Verification email sent too recently, try again later"},
+	{db.ErrInvalidResetToken, http.StatusBadRequest, "invalid_reset_token", "Invalid or expired reset token"},
+	{db.ErrSessionNotFound, http.StatusNotFound, "session_not_found", "Session not found"},
+	{db.ErrAPIKeyNotFound, http.StatusNotFound, "api_key_not_found", "API key not found"},
+	{db.ErrIdentityNotFound, http.StatusNotFound, "identity_not_found", "Identity not found"},
+	{db.ErrIdentityAlreadyLinked, http.StatusConflict, "identity_already_linked", "This identity is already linked to an account"},
+	{db.ErrLastLoginMethod, http.StatusConflict, "last_login_method", "Set a password before removing your only linked identity"},
+	{db.ErrCannotFollowSelf, http.StatusBadRequest, "cannot_follow_self", "You cannot follow yourself"},
+	{db.ErrInvalidReaction, http.StatusBadRequest, "invalid_reaction", "Invalid reaction"},
+	{db.ErrInvalidRecoveryCode, http.StatusUnauthorized, "invalid_two_factor_code", "Invalid two-factor code"},
+	{db.ErrTOTPCodeReused, http.StatusUnauthorized, "invalid_two_factor_code", "Invalid two-factor code"},
+	{errInvalidPageParams, http.StatusBadRequest, "invalid_page_params", "Invalid cursor or limit"},
+}
+
+// writeError writes the response for err: the mapped response for errors
+// in errorResponses, err itself for an *apierror.Error, and a generic 500
+// for anything else, which is logged
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, resp := range errorResponses {
+		if errors.Is(err, resp.err) {
+			apierror.Write(w, r, apierror.New(resp.status, resp.code, resp.detail))
+			return
+		}
+	}
+
+	apierror.Write(w, r, err)
+}
+
+// writeProblem writes a problem response with the given status, code and
+// detail message
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	apierror.Write(w, r, apierror.New(status, code, detail))
+}
+
+// writeUnauthorized is the response for requests that reach a protected
+// handler without credentials
+func writeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+}
+
+// writeMethodNotAllowed is the response for methods a route doesn't support
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "Method not allowed")
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"blog2/db"
+	"blog2/feed"
+	"blog2/models"
+)
+
+// SiteConfig describes the public site, for feeds, sitemaps and other
+// documents that link back to it
+type SiteConfig struct {
+	PublicURL   string // Base URL of the site, used in every link
+	Title       string // Title of the site feeds
+	Description string // Description of the site feeds
+	FeedItems   int    // Number of posts in each feed
+
+	RobotsDisallow    []string // Paths robots.txt asks crawlers to skip
+	RobotsDisallowAll bool     // Ask crawlers to skip the whole site, e.g. for staging
+}
+
+// DefaultSiteConfig returns a default site configuration
+func DefaultSiteConfig() SiteConfig {
+	return SiteConfig{
+		PublicURL:   "http://localhost:8080",
+		Title:       "Blog",
+		Description: "Latest posts",
+		FeedItems:   20,
+
+		RobotsDisallow: []string{"/auth/", "/users/me/"},
+	}
+}
+
+// feedFormat is one of the feed document formats
+type feedFormat struct {
+	contentType string
+	render      func(feed.Feed) ([]byte, error)
+}
+
+// feedFormats maps feed paths to their formats
+var feedFormats = map[string]feedFormat{
+	"/feed.rss":  {"application/rss+xml; charset=utf-8", feed.RSS},
+	"/feed.atom": {"application/atom+xml; charset=utf-8", feed.Atom},
+	"/feed.json": {"application/feed+json; charset=utf-8", feed.JSON},
+}
+
+// FeedsHandler serves the latest posts as RSS, Atom and JSON Feed documents
+type FeedsHandler struct {
+	DB     *db.DB
+	Config SiteConfig
+}
+
+// NewFeedsHandler creates a new FeedsHandler
+func NewFeedsHandler(db *db.DB, config SiteConfig) *FeedsHandler {
+	return &FeedsHandler{DB: db, Config: config}
+}
+
+// ServeHTTP handles GET /feed.rss, /feed.atom and /feed.json, optionally
+// limited to one author with ?author=
+func (h *FeedsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	format, ok := feedFormats[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, ok := h.buildFeed(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := format.render(f)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("rendering feed: %w", err))
+		return
+	}
+
+	serveCached(w, r, format.contentType, f.Updated, body)
+}
+
+// serveCached writes a generated document with an ETag and Last-Modified
+// time, so that clients can revalidate with If-None-Match or
+// If-Modified-Since and get a 304 instead of downloading it again
+func serveCached(w http.ResponseWriter, r *http.Request, contentType string, modified time.Time, body []byte) {
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+// buildFeed loads the posts for a feed request. It writes an error response
+// and returns false on failure.
+func (h *FeedsHandler) buildFeed(w http.ResponseWriter, r *http.Request) (feed.Feed, bool) {
+	base := strings.TrimSuffix(h.Config.PublicURL, "/")
+	author := r.URL.Query().Get("author")
+
+	f := feed.Feed{
+		Title:       h.Config.Title,
+		Description: h.Config.Description,
+		Link:        base + "/",
+		FeedURL:     base + r.URL.Path,
+	}
+
+	if author != "" {
+		// Authors with private profiles have no public feed
+		user, err := h.DB.GetUserByUsername(r.Context(), author)
+		if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+			writeError(w, r, fmt.Errorf("retrieving author: %w", err))
+			return feed.Feed{}, false
+		}
+		if err == nil && user.ProfilePrivate {
+			writeProblem(w, r, http.StatusNotFound, "author_not_found", "Author not found")
+			return feed.Feed{}, false
+		}
+
+		name := author
+		if user.DisplayName != "" {
+			name = user.DisplayName
+		}
+
+		f.Title = h.Config.Title + ": " + name
+		f.Description = "Latest posts by " + name
+		f.Link = base + "/users/" + url.PathEscape(author)
+		f.FeedURL += "?author=" + url.QueryEscape(author)
+	}
+
+	posts, err := h.DB.GetLatestPosts(r.Context(), author, h.Config.FeedItems)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving posts: %w", err))
+		return feed.Feed{}, false
+	}
+
+	for _, post := range posts {
+		f.Items = append(f.Items, feedItem(base, post))
+	}
+	f.Updated = feed.LatestUpdate(f.Items)
+
+	return f, true
+}
+
+// feedItem converts a post to a feed item linking to it under base
+func feedItem(base string, post models.Post) feed.Item {
+	link := base + "/posts/" + strconv.Itoa(post.ID)
+	return feed.Item{
+		ID:        link,
+		Title:     post.Title,
+		Link:      link,
+		Content:   post.Content,
+		Author:    post.CreatedBy,
+		Published: post.DateCreated,
+		Updated:   post.DateUpdated,
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"blog2/auth"
+	"blog2/models"
+)
+
+// follow makes the current user follow another user
+func (h *UsersHandler) follow(w http.ResponseWriter, r *http.Request, username string) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	user, ok := h.visibleProfile(w, r, username)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Follow(r.Context(), claims.UserID, user.ID); err != nil {
+		writeError(w, r, fmt.Errorf("following user: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unfollow stops the current user following another user
+func (h *UsersHandler) unfollow(w http.ResponseWriter, r *http.Request, username string) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	// Unfollowing is allowed even if the profile has since become private
+	user, err := h.DB.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		return
+	}
+
+	if err := h.DB.Unfollow(r.Context(), claims.UserID, user.ID); err != nil {
+		writeError(w, r, fmt.Errorf("unfollowing user: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFollowers returns a page of the users following a user
+func (h *UsersHandler) getFollowers(w http.ResponseWriter, r *http.Request, username string) {
+	h.writeFollowList(w, r, username, h.DB.GetFollowers)
+}
+
+// getFollowing returns a page of the users a user follows
+func (h *UsersHandler) getFollowing(w http.ResponseWriter, r *http.Request, username string) {
+	h.writeFollowList(w, r, username, h.DB.GetFollowing)
+}
+
+// writeFollowList writes one page of a follower or following list
+func (h *UsersHandler) writeFollowList(
+	w http.ResponseWriter, r *http.Request, username string,
+	list func(ctx context.Context, userID int, before time.Time, beforeID int, limit int) ([]models.FollowEntry, error),
+) {
+	before, beforeID, limit, err := pageParams(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_page_params", "Invalid cursor or limit")
+		return
+	}
+
+	user, ok := h.visibleProfile(w, r, username)
+	if !ok {
+		return
+	}
+
+	entries, err := list(r.Context(), user.ID, before, beforeID, limit)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving users: %w", err))
+		return
+	}
+
+	response := models.FollowListResponse{Users: entries}
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		response.NextCursor = encodeCursor(last.FollowedAt, last.UserID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
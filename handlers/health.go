@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/migrate"
+	"blog2/models"
+)
+
+// HealthConfig holds configuration for the health endpoints
+type HealthConfig struct {
+	ReadyTimeout time.Duration // How long dependencies get to answer a readiness check
+}
+
+// DefaultHealthConfig returns a default health configuration
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		ReadyTimeout: 2 * time.Second,
+	}
+}
+
+// errDraining is reported by readiness checks once shutdown has begun
+var errDraining = errors.New("server is shutting down")
+
+// HealthHandler serves the liveness, readiness and detailed health endpoints
+type HealthHandler struct {
+	DB       *db.DB
+	Migrator *migrate.Migrator
+	Config   HealthConfig
+
+	started  time.Time
+	draining atomic.Bool
+}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler(db *db.DB, migrator *migrate.Migrator, config HealthConfig) *HealthHandler {
+	return &HealthHandler{DB: db, Migrator: migrator, Config: config, started: time.Now()}
+}
+
+// SetDraining makes readiness checks fail from now on, so that load
+// balancers stop sending requests while the server shuts down
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// ServeHTTP handles all HTTP requests for health
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	// Route based on path
+	switch r.URL.Path {
+	case "/healthz":
+		h.live(w, r)
+	case "/readyz":
+		h.ready(w, r)
+	case "/health/details":
+		h.details(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// live reports that the process is up and serving requests. It checks no
+// dependencies, so that a database outage doesn't get the server restarted.
+func (h *HealthHandler) live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, models.HealthReport{Status: models.HealthOK, Checks: []models.HealthCheck{}})
+}
+
+// ready reports whether the server should be sent requests: the database
+// answers in time, its schema is at the version this build expects, and the
+// server isn't shutting down. Failure details are left out, as the endpoint
+// is public.
+func (h *HealthHandler) ready(w http.ResponseWriter, r *http.Request) {
+	report := h.check(r.Context())
+	for i := range report.Checks {
+		report.Checks[i].Detail = ""
+	}
+
+	writeHealth(w, healthStatusCode(report), report)
+}
+
+// details reports the checks with their failures, and the state of the
+// server and its connection pool. Only admins signed in with a session may
+// see it; API keys never can.
+func (h *HealthHandler) details(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	if !requireScope(w, r, auth.ScopeAccount) {
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		return
+	}
+	if user.Role != models.RoleAdmin {
+		writeProblem(w, r, http.StatusForbidden, "admin_required", "Only admins can see health details")
+		return
+	}
+
+	report := h.check(r.Context())
+	stats := h.DB.Stats()
+
+	details := models.HealthDetails{
+		HealthReport:    report,
+		StartedAt:       h.started,
+		UptimeSeconds:   time.Since(h.started).Seconds(),
+		Draining:        h.draining.Load(),
+		LatestMigration: h.Migrator.Latest(),
+		DatabasePool: models.DatabasePoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitSeconds:        stats.WaitDuration.Seconds(),
+		},
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	// A failed version lookup is already reported by the migrations check
+	if version, err := h.Migrator.Version(r.Context()); err == nil {
+		details.SchemaVersion = version
+	}
+
+	writeHealth(w, healthStatusCode(report), details)
+}
+
+// check runs every readiness check, giving them ReadyTimeout in total
+func (h *HealthHandler) check(ctx context.Context) models.HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, h.Config.ReadyTimeout)
+	defer cancel()
+
+	report := models.HealthReport{Status: models.HealthOK}
+	for _, c := range []struct {
+		name string
+		fn   func(ctx context.Context) error
+	}{
+		{"shutdown", h.checkDraining},
+		{"database", h.DB.PingContext},
+		{"migrations", h.checkMigrations},
+	} {
+		start := time.Now()
+		err := c.fn(ctx)
+
+		result := models.HealthCheck{
+			Name:       c.name,
+			Status:     models.HealthOK,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result.Status = models.HealthUnavailable
+			result.Detail = err.Error()
+			report.Status = models.HealthUnavailable
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	return report
+}
+
+// checkDraining fails once shutdown has begun
+func (h *HealthHandler) checkDraining(ctx context.Context) error {
+	if h.draining.Load() {
+		return errDraining
+	}
+	return nil
+}
+
+// checkMigrations fails if the database schema is older than the latest
+// version this build knows. A newer schema is fine: during a rolling deploy
+// the new build migrates while the old one is still serving.
+func (h *HealthHandler) checkMigrations(ctx context.Context) error {
+	version, err := h.Migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version < h.Migrator.Latest() {
+		return fmt.Errorf("database schema is at version %d, expected at least %d", version, h.Migrator.Latest())
+	}
+	return nil
+}
+
+// healthStatusCode returns 200 for a healthy report and 503 otherwise
+func healthStatusCode(report models.HealthReport) int {
+	if report.Status != models.HealthOK {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// writeHealth writes a health response, which must never be cached
+func writeHealth(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"blog2/apierror"
+	"blog2/auth"
+	"blog2/db/dbtest"
+	"blog2/migrate"
+	"blog2/migrations"
+	"blog2/models"
+)
+
+// withFutureMigration returns the migrations of this build plus one more
+func withFutureMigration(t *testing.T) fs.FS {
+	t.Helper()
+
+	entries, err := fs.ReadDir(migrations.FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{}
+	for _, entry := range entries {
+		data, err := fs.ReadFile(migrations.FS, entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys[entry.Name()] = &fstest.MapFile{Data: data}
+	}
+
+	loaded, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := loaded[len(loaded)-1].Version + 1
+	fsys[fmt.Sprintf("%02d_future.up.sql", next)] = &fstest.MapFile{Data: []byte("SELECT 1")}
+
+	return fsys
+}
+
+func TestCheckMigrations(t *testing.T) {
+	database := dbtest.Open(t)
+
+	tests := []struct {
+		name    string
+		fsys    fs.FS
+		wantErr bool
+	}{
+		{"same build", migrations.FS, false},
+		{"older build", fstest.MapFS{"01_create_posts_table.up.sql": {Data: []byte("SELECT 1")}}, false},
+		{"newer build", withFutureMigration(t), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, err := migrate.New(database.DB, tt.fsys)
+			if err != nil {
+				t.Fatalf("migrate.New: %v", err)
+			}
+
+			h := NewHealthHandler(database, migrator, DefaultHealthConfig())
+			err = h.checkMigrations(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMigrations = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthDetailsRejected(t *testing.T) {
+	// Both are refused before the user is looked up, so no database is needed
+	apiKey := models.TokenClaims{UserID: 1, Username: "admin", APIKeyID: 7, Scopes: []string{auth.ScopePostsRead, auth.ScopePostsWrite, auth.ScopeProfileRead}}
+
+	tests := []struct {
+		name       string
+		claims     *models.TokenClaims
+		wantStatus int
+		wantCode   string
+	}{
+		{"not authenticated", nil, http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"API key", &apiKey, http.StatusForbidden, "insufficient_scope"},
+	}
+
+	h := NewHealthHandler(nil, nil, DefaultHealthConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/health/details", nil)
+			if tt.claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), auth.UserClaimsKey, *tt.claims))
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			assertProblem(t, rec, tt.wantStatus, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blog2/db"
+	"blog2/metrics"
+)
+
+// LockoutConfig holds configuration for brute-force protection on login
+type LockoutConfig struct {
+	Window             time.Duration // How far back failed attempts are counted
+	MaxAccountFailures int           // Failures for one username before it is locked
+	MaxIPFailures      int           // Failures from one IP address before it is locked
+	LockoutDuration    time.Duration // How long a lockout lasts
+	DelayAfter         int           // Failures before responses start being delayed
+	BaseDelay          time.Duration // First delay, doubled for each further failure
+	MaxDelay           time.Duration // Upper bound on the delay
+}
+
+// DefaultLockoutConfig returns a default lockout configuration
+func DefaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		Window:             15 * time.Minute,
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		LockoutDuration:    15 * time.Minute,
+		DelayAfter:         2,
+		BaseDelay:          500 * time.Millisecond,
+		MaxDelay:           5 * time.Second,
+	}
+}
+
+// checkLockout reports whether the username or client IP is locked out,
+// writing a 429 response if so
+func (h *UsersHandler) checkLockout(w http.ResponseWriter, r *http.Request, username string, ip string) bool {
+	lockedUntil, err := h.DB.GetActiveLockout(r.Context(), username, ip)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("authenticating user: %w", err))
+		return true
+	}
+
+	if lockedUntil == nil {
+		return false
+	}
+
+	retryAfter := int(time.Until(*lockedUntil).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeProblem(w, r, http.StatusTooManyRequests, "too_many_login_attempts", "Too many failed login attempts, try again later")
+	return true
+}
+
+// recordFailedLogin stores a failed attempt, locks the username or IP address
+// out if a limit has been reached, and returns how long to delay the response
+func (h *UsersHandler) recordFailedLogin(ctx context.Context, username string, ip string) time.Duration {
+	config := h.AccountConfig.Lockout
+	h.Metrics.Login(metrics.LoginFailure)
+
+	if err := h.DB.RecordLoginAttempt(ctx, username, ip, false); err != nil {
+		slog.ErrorContext(ctx, "Error recording login attempt", "err", err)
+		return config.MaxDelay
+	}
+
+	accountFailures, ipFailures, err := h.DB.CountFailedLogins(ctx, username, ip, time.Now().Add(-config.Window))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting failed logins", "err", err)
+		return config.MaxDelay
+	}
+
+	lockedUntil := time.Now().Add(config.LockoutDuration)
+	if accountFailures >= config.MaxAccountFailures {
+		h.lockOut(ctx, db.LockoutScopeAccount, username, ip, accountFailures, lockedUntil)
+	}
+	if ipFailures >= config.MaxIPFailures {
+		h.lockOut(ctx, db.LockoutScopeIP, username, ip, ipFailures, lockedUntil)
+	}
+
+	return loginDelay(config, max(accountFailures, ipFailures))
+}
+
+// lockOut records a lockout in the audit table
+func (h *UsersHandler) lockOut(ctx context.Context, scope string, username string, ip string, failures int, lockedUntil time.Time) {
+	slog.WarnContext(ctx, "Locking out after failed logins",
+		"scope", scope, "failures", failures, "username", username, "ip", ip, "until", lockedUntil)
+	h.Metrics.Lockout(scope)
+
+	if err := h.DB.CreateLockout(ctx, scope, username, ip, failures, lockedUntil); err != nil {
+		slog.ErrorContext(ctx, "Error recording lockout", "err", err)
+	}
+}
+
+// recordSuccessfulLogin stores a successful attempt, which resets the
+// failure count for the username
+func (h *UsersHandler) recordSuccessfulLogin(ctx context.Context, username string, ip string) {
+	h.Metrics.Login(metrics.LoginSuccess)
+	if err := h.DB.RecordLoginAttempt(ctx, username, ip, true); err != nil {
+		slog.ErrorContext(ctx, "Error recording login attempt", "err", err)
+	}
+}
+
+// loginDelay returns the progressive delay for the given number of failures
+func loginDelay(config LockoutConfig, failures int) time.Duration {
+	if failures <= config.DelayAfter {
+		return 0
+	}
+
+	delay := config.BaseDelay
+	for i := config.DelayAfter + 1; i < failures && delay < config.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, config.MaxDelay)
+}
+
+// sleepContext waits for d or until the request is cancelled
+func sleepContext(r *http.Request, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
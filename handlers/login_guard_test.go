@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	config := DefaultLockoutConfig() // DelayAfter 2, BaseDelay 500ms, MaxDelay 5s
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", 0, 0},
+		{"below the threshold", 1, 0},
+		{"at the threshold", 2, 0},
+		{"first delayed failure", 3, 500 * time.Millisecond},
+		{"doubled", 4, time.Second},
+		{"doubled twice", 5, 2 * time.Second},
+		{"last step below the cap", 6, 4 * time.Second},
+		{"reaches the cap", 7, 5 * time.Second},
+		{"stays at the cap", 8, 5 * time.Second},
+		{"many failures", 1000, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := loginDelay(config, tt.failures); got != tt.want {
+			t.Errorf("%s: loginDelay(%d) = %v, want %v", tt.name, tt.failures, got, tt.want)
+		}
+	}
+}
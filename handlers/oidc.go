@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/models"
+	"blog2/oidc"
+)
+
+// oidcFlowCookie holds the signed state of a login between the redirect to
+// the provider and the callback
+const (
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+// OIDCHandler handles login and account linking through OpenID Connect providers
+type OIDCHandler struct {
+	Users     *UsersHandler
+	Providers map[string]*oidc.Provider
+}
+
+// NewOIDCHandler creates a new OIDCHandler. Logins are completed through
+// users so that two-factor authentication still applies.
+func NewOIDCHandler(users *UsersHandler, providers []*oidc.Provider) *OIDCHandler {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, p := range providers {
+		byName[p.Config.Name] = p
+	}
+
+	return &OIDCHandler{
+		Users:     users,
+		Providers: byName,
+	}
+}
+
+// ServeHTTP handles all HTTP requests for OpenID Connect
+func (h *OIDCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Route based on HTTP method and path
+	if strings.HasPrefix(r.URL.Path, "/auth/oidc/") {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/auth/oidc/"), "/")
+		switch {
+		case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "login":
+			h.login(w, r, parts[0])
+		case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "callback":
+			h.callback(w, r, parts[0])
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	if !requireScope(w, r, auth.ScopeAccount) {
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/users/me/identities"), "/")
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		h.getIdentities(w, r)
+	case r.Method == http.MethodPost && path != "":
+		h.startLink(w, r, path[1:]) // Remove leading slash
+	case r.Method == http.MethodDelete && path != "":
+		id, err := strconv.Atoi(path[1:]) // Remove leading slash
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "invalid_identity_id", "Invalid identity ID")
+			return
+		}
+		h.deleteIdentity(w, r, id)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+// login redirects the browser to the provider to start a login
+func (h *OIDCHandler) login(w http.ResponseWriter, r *http.Request, providerName string) {
+	authURL, ok := h.startFlow(w, r, providerName, 0)
+	if !ok {
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// startLink begins linking a provider identity to the current user. It
+// returns the authorization URL for the client to open in the browser.
+func (h *OIDCHandler) startLink(w http.ResponseWriter, r *http.Request, providerName string) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	authURL, ok := h.startFlow(w, r, providerName, claims.UserID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AuthorizationURLResponse{AuthorizationURL: authURL})
+}
+
+// startFlow generates the state, nonce and PKCE verifier for a new flow,
+// stores them in a signed cookie and returns the provider's authorization URL
+func (h *OIDCHandler) startFlow(w http.ResponseWriter, r *http.Request, providerName string, linkUserID int) (string, bool) {
+	provider, ok := h.Providers[providerName]
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, "unknown_provider", "Unknown identity provider")
+		return "", false
+	}
+
+	flow := auth.OIDCFlowClaims{
+		Provider:   providerName,
+		LinkUserID: linkUserID,
+	}
+
+	var err error
+	if flow.State, err = oidc.RandomString(); err == nil {
+		if flow.Nonce, err = oidc.RandomString(); err == nil {
+			flow.CodeVerifier, err = oidc.RandomString()
+		}
+	}
+	if err != nil {
+		writeError(w, r, fmt.Errorf("starting login: %w", err))
+		return "", false
+	}
+
+	flowToken, err := auth.GenerateOIDCFlowToken(flow, oidcFlowTTL, h.Users.JWTConfig)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("starting login: %w", err))
+		return "", false
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), flow.State, flow.Nonce, flow.CodeVerifier)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error contacting identity provider", "provider", providerName, "err", err)
+		writeProblem(w, r, http.StatusBadGateway, "provider_unavailable", "Identity provider is unavailable")
+		return "", false
+	}
+
+	h.setFlowCookie(w, flowToken, int(oidcFlowTTL.Seconds()))
+	return authURL, true
+}
+
+// callback finishes a flow after the provider redirects back
+func (h *OIDCHandler) callback(w http.ResponseWriter, r *http.Request, providerName string) {
+	provider, ok := h.Providers[providerName]
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, "unknown_provider", "Unknown identity provider")
+		return
+	}
+
+	// The flow cookie is single-use
+	cookie, err := r.Cookie(oidcFlowCookie)
+	h.setFlowCookie(w, "", -1)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "login_session_expired", "Login session not found or expired, please try again")
+		return
+	}
+
+	flow, err := auth.ValidateOIDCFlowToken(cookie.Value, h.Users.JWTConfig)
+	if err != nil || flow.Provider != providerName {
+		writeProblem(w, r, http.StatusBadRequest, "login_session_expired", "Login session not found or expired, please try again")
+		return
+	}
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_login_state", "Invalid login state")
+		return
+	}
+
+	if query.Get("error") != "" {
+		writeProblem(w, r, http.StatusBadRequest, "login_denied", "Login was cancelled or denied by the identity provider")
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error completing login with identity provider", "provider", providerName, "err", err)
+		writeProblem(w, r, http.StatusBadGateway, "provider_login_failed", "Could not complete login with the identity provider")
+		return
+	}
+
+	if flow.LinkUserID != 0 {
+		h.finishLink(w, r, flow.LinkUserID, providerName, identity)
+	} else {
+		h.finishLogin(w, r, providerName, identity)
+	}
+}
+
+// finishLink links a verified identity to the user who started the flow
+func (h *OIDCHandler) finishLink(w http.ResponseWriter, r *http.Request, userID int, providerName string, identity oidc.IDTokenClaims) {
+	linked, err := h.Users.DB.CreateIdentity(r.Context(), userID, providerName, identity.Subject, identity.Email)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("linking identity: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(linked)
+}
+
+// finishLogin logs in the user linked to a verified identity, creating a new
+// user if the identity has not been seen before
+func (h *OIDCHandler) finishLogin(w http.ResponseWriter, r *http.Request, providerName string, identity oidc.IDTokenClaims) {
+	linked, err := h.Users.DB.GetIdentity(r.Context(), providerName, identity.Subject)
+	if err == nil {
+		user, err := h.Users.DB.GetUserByID(r.Context(), linked.UserID)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+			return
+		}
+
+		if err := h.Users.DB.UpdateLastLogin(r.Context(), user.ID); err != nil {
+			writeError(w, r, fmt.Errorf("authenticating user: %w", err))
+			return
+		}
+
+		h.Users.completeLogin(w, r, user)
+		return
+	}
+
+	if !errors.Is(err, db.ErrIdentityNotFound) {
+		writeError(w, r, fmt.Errorf("retrieving identity: %w", err))
+		return
+	}
+
+	if identity.Email == "" {
+		writeProblem(w, r, http.StatusBadRequest, "provider_email_missing", "The identity provider did not share an email address")
+		return
+	}
+
+	// Never attach an identity to an existing account without that account's
+	// owner being logged in, or anyone controlling a provider account with the
+	// same email could take it over
+	if _, err := h.Users.DB.GetUserByEmail(r.Context(), identity.Email); err == nil {
+		writeProblem(w, r, http.StatusConflict, "email_in_use", "An account with this email already exists. Log in and link this provider from your account instead.")
+		return
+	} else if !errors.Is(err, db.ErrUserNotFound) {
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		return
+	}
+
+	username, err := h.Users.DB.AvailableUsername(r.Context(), usernameFromIdentity(identity))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("creating user: %w", err))
+		return
+	}
+
+	user, err := h.Users.DB.CreateExternalUser(r.Context(), username, identity.Email, identity.EmailVerified, providerName, identity.Subject)
+	if err != nil {
+		if errors.Is(err, db.ErrUserAlreadyExists) || errors.Is(err, db.ErrIdentityAlreadyLinked) {
+			writeProblem(w, r, http.StatusConflict, "concurrent_signup", "Account was created concurrently, please try again")
+		} else {
+			writeError(w, r, fmt.Errorf("creating user: %w", err))
+		}
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		go h.Users.sendVerificationEmail(context.WithoutCancel(r.Context()), user)
+	}
+
+	h.Users.writeLoginResponse(w, r, user, http.StatusCreated)
+}
+
+// getIdentities lists the identities linked to the current user
+func (h *OIDCHandler) getIdentities(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	identities, err := h.Users.DB.GetIdentitiesByUser(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving identities: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// deleteIdentity unlinks an identity from the current user
+func (h *OIDCHandler) deleteIdentity(w http.ResponseWriter, r *http.Request, id int) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	err := h.Users.DB.DeleteIdentity(r.Context(), claims.UserID, id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("removing identity: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setFlowCookie sets or, with a negative maxAge, clears the flow cookie
+func (h *OIDCHandler) setFlowCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/auth/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.Users.AccountConfig.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// usernameFromIdentity derives a username from the provider's claims,
+// keeping only characters that are safe in URLs
+func usernameFromIdentity(identity oidc.IDTokenClaims) string {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, c := range strings.ToLower(base) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.' {
+			b.WriteRune(c)
+		}
+	}
+
+	username := b.String()
+	if len(username) > 45 {
+		username = username[:45] // Leave room for a numeric suffix
+	}
+	for len(username) < 3 || models.IsReservedUsername(username) {
+		username += "_"
+	}
+
+	return username
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"blog2/apierror"
+	"blog2/auth"
+	"blog2/db"
+	"blog2/db/dbtest"
+	"blog2/models"
+	"blog2/oidc"
+	"blog2/oidc/oidctest"
+)
+
+// newTestOIDCHandler returns a handler for a mock provider named "mock" that
+// logs every visitor in as user
+func newTestOIDCHandler(t *testing.T, user oidctest.User) *OIDCHandler {
+	t.Helper()
+
+	server := oidctest.NewServer("client", "secret", user)
+	t.Cleanup(server.Close)
+
+	users, _ := newTestUsersHandler()
+	provider := oidc.NewProvider(oidc.ProviderConfig{
+		Name:         "mock",
+		IssuerURL:    server.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  users.AccountConfig.PublicURL + "/auth/oidc/mock/callback",
+	})
+
+	return NewOIDCHandler(users, []*oidc.Provider{provider})
+}
+
+// oidcLogin starts a login and follows the provider's redirect back. It
+// returns the flow cookie and the query the callback would receive.
+func oidcLogin(t *testing.T, h *OIDCHandler) (*http.Cookie, url.Values) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d: %s", rec.Code, http.StatusFound, rec.Body)
+	}
+
+	var flowCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcFlowCookie {
+			flowCookie = c
+		}
+	}
+	if flowCookie == nil {
+		t.Fatal("login did not set the flow cookie")
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorizing: %v", err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing callback URL: %v", err)
+	}
+
+	return flowCookie, callback.Query()
+}
+
+// oidcCallback calls the callback with query and, if not nil, the flow cookie
+func oidcCallback(h *OIDCHandler, query url.Values, flowCookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+query.Encode(), nil)
+	if flowCookie != nil {
+		r.AddCookie(flowCookie)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// reflowCookie returns a flow cookie with the flow in cookie changed by edit
+func reflowCookie(t *testing.T, cookie *http.Cookie, edit func(*auth.OIDCFlowClaims)) *http.Cookie {
+	t.Helper()
+
+	flow, err := auth.ValidateOIDCFlowToken(cookie.Value, testJWTConfig)
+	if err != nil {
+		t.Fatalf("ValidateOIDCFlowToken: %v", err)
+	}
+	edit(&flow)
+
+	token, err := auth.GenerateOIDCFlowToken(flow, oidcFlowTTL, testJWTConfig)
+	if err != nil {
+		t.Fatalf("GenerateOIDCFlowToken: %v", err)
+	}
+
+	return &http.Cookie{Name: oidcFlowCookie, Value: token}
+}
+
+// assertProblem checks the status and code of an error response
+func assertProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+
+	var problem apierror.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	if problem.Code != code {
+		t.Errorf("code = %q, want %q", problem.Code, code)
+	}
+}
+
+func TestOIDCLoginUsesPKCE(t *testing.T) {
+	h := newTestOIDCHandler(t, oidctest.User{Subject: "123"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v, want an HttpOnly flow cookie", cookies)
+	}
+
+	flow, err := auth.ValidateOIDCFlowToken(cookies[0].Value, testJWTConfig)
+	if err != nil {
+		t.Fatalf("ValidateOIDCFlowToken: %v", err)
+	}
+
+	authURL, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+
+	if query.Get("state") != flow.State || query.Get("nonce") != flow.Nonce {
+		t.Errorf("state and nonce = %q, %q; want %q, %q", query.Get("state"), query.Get("nonce"), flow.State, flow.Nonce)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") != oidc.CodeChallengeS256(flow.CodeVerifier) {
+		t.Errorf("code challenge = %q (%s), want the S256 challenge of the flow's verifier",
+			query.Get("code_challenge"), query.Get("code_challenge_method"))
+	}
+}
+
+func TestOIDCCallbackRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		prepare    func(t *testing.T, cookie *http.Cookie, query url.Values) (*http.Cookie, url.Values)
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name: "no flow cookie",
+			prepare: func(t *testing.T, cookie *http.Cookie, query url.Values) (*http.Cookie, url.Values) {
+				return nil, query
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "login_session_expired",
+		},
+		{
+			name: "flow for another provider",
+			prepare: func(t *testing.T, cookie *http.Cookie, query url.Values) (*http.Cookie, url.Values) {
+				return reflowCookie(t, cookie, func(flow *auth.OIDCFlowClaims) { flow.Provider = "other" }), query
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "login_session_expired",
+		},
+		{
+			name: "state mismatch",
+			prepare: func(t *testing.T, cookie *http.Cookie, query url.Values) (*http.Cookie, url.Values) {
+				query.Set("state", "forged-state")
+				return cookie, query
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_login_state",
+		},
+		{
+			name: "missing state",
+			prepare: func(t *testing.T, cookie *http.Cookie, query url.Values) (*http.Cookie, url.Values) {
+				query.Del("state")
+				return cookie, query
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_login_state",
+		},
+		{
+			name: "nonce mismatch",
+			prepare: func(t *testing.T, cookie *http.Cookie, query url.Values) (*http.Cookie, url.Values) {
+				return reflowCookie(t, cookie, func(flow *auth.OIDCFlowClaims) { flow.Nonce = "forged-nonce" }), query
+			},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   "provider_login_failed",
+		},
+		{
+			name: "wrong PKCE verifier",
+			prepare: func(t *testing.T, cookie *http.Cookie, query url.Values) (*http.Cookie, url.Values) {
+				return reflowCookie(t, cookie, func(flow *auth.OIDCFlowClaims) { flow.CodeVerifier = "forged-verifier" }), query
+			},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   "provider_login_failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestOIDCHandler(t, oidctest.User{Subject: "123", Email: "john@example.com", EmailVerified: true})
+
+			cookie, query := oidcLogin(t, h)
+			cookie, query = tt.prepare(t, cookie, query)
+			rec := oidcCallback(h, query, cookie)
+
+			assertProblem(t, rec, tt.wantStatus, tt.wantCode)
+		})
+	}
+}
+
+func TestOIDCLoginExistingEmail(t *testing.T) {
+	h := newTestOIDCHandler(t, oidctest.User{Subject: "123", Email: "john@example.com", EmailVerified: true})
+	h.Users.DB = dbtest.Open(t)
+	ctx := context.Background()
+
+	user, err := h.Users.DB.CreateUser(ctx, models.NewUser{Username: "johndoe", Email: "john@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	cookie, query := oidcLogin(t, h)
+	rec := oidcCallback(h, query, cookie)
+	assertProblem(t, rec, http.StatusConflict, "email_in_use")
+
+	// The identity must not have been attached to the existing account
+	if _, err := h.Users.DB.GetIdentity(ctx, "mock", "123"); !errors.Is(err, db.ErrIdentityNotFound) {
+		t.Errorf("GetIdentity = %v, want %v", err, db.ErrIdentityNotFound)
+	}
+	identities, err := h.Users.DB.GetIdentitiesByUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetIdentitiesByUser: %v", err)
+	}
+	if len(identities) != 0 {
+		t.Errorf("existing user has %d identities, want none", len(identities))
+	}
+}
+
+func TestOIDCLoginNewUser(t *testing.T) {
+	h := newTestOIDCHandler(t, oidctest.User{Subject: "123", Email: "john@example.com", EmailVerified: true, PreferredUsername: "johndoe"})
+	h.Users.DB = dbtest.Open(t)
+
+	cookie, query := oidcLogin(t, h)
+	rec := oidcCallback(h, query, cookie)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	var response models.LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if response.User.Username != "johndoe" || response.User.Email != "john@example.com" || response.Token == "" {
+		t.Errorf("response = %+v, want a token for the new user johndoe", response)
+	}
+}
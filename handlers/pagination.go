@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Page sizes for keyset-paginated lists
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidPageParams = errors.New("invalid cursor or limit")
+
+// pageParams reads the cursor and limit query parameters of a paginated
+// request. A missing cursor returns a zero before time for the first page.
+func pageParams(r *http.Request) (before time.Time, beforeID int, limit int, err error) {
+	limit = defaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return time.Time{}, 0, 0, errInvalidPageParams
+		}
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		before, beforeID, err = decodeCursor(cursor)
+		if err != nil {
+			return time.Time{}, 0, 0, errInvalidPageParams
+		}
+	}
+
+	return before, beforeID, limit, nil
+}
+
+// encodeCursor builds an opaque cursor pointing just past a row
+func encodeCursor(t time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", t.UnixNano(), id)))
+}
+
+// decodeCursor parses a cursor made by encodeCursor
+func decodeCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var nanos int64
+	var id int
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &nanos, &id); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return time.Unix(0, nanos).UTC(), id, nil
+}
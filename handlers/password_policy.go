@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"blog2/apierror"
+	"blog2/password"
+)
+
+// checkPasswordPolicy checks a new password, sent in the named field,
+// against the password policy. If it does not pass, it writes a 422
+// response listing every failed rule and returns false.
+func (h *UsersHandler) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, field string, candidate password.Candidate) bool {
+	violations, err := h.PasswordPolicy.Validate(candidate)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("checking password: %w", err))
+		return false
+	}
+
+	if len(violations) == 0 {
+		return true
+	}
+
+	fields := make([]apierror.FieldError, len(violations))
+	for i, v := range violations {
+		fields[i] = apierror.FieldError{Field: field, Code: v.Rule, Message: v.Message}
+	}
+
+	apierror.Write(w, r, apierror.New(http.StatusUnprocessableEntity, "password_policy",
+		"Password does not meet the password policy").WithFields(fields))
+	return false
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/mail"
+	"blog2/models"
+	"blog2/password"
+)
+
+// forgotPasswordResponse is returned whether or not the email is registered,
+// so the endpoint cannot be used to discover accounts
+const forgotPasswordResponse = "If an account exists for that email, a password reset link has been sent"
+
+// forgotPassword issues a password reset token and emails it to the user
+func (h *UsersHandler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgotRequest models.ForgotPasswordRequest
+	if !decodeJSON(w, r, &forgotRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(forgotRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	// Issue and send the token in the background so that the response time
+	// does not depend on whether the account exists
+	go h.sendPasswordReset(context.WithoutCancel(r.Context()), forgotRequest.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(models.MessageResponse{Message: forgotPasswordResponse})
+}
+
+// sendPasswordReset creates a reset token for the user with the given email
+// and mails it. Failures are logged since the client has already been answered.
+func (h *UsersHandler) sendPasswordReset(ctx context.Context, email string) {
+	user, err := h.DB.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, db.ErrUserNotFound) {
+			slog.ErrorContext(ctx, "Error looking up user for password reset", "err", err)
+		}
+		return
+	}
+
+	token, err := auth.GenerateRandomToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error generating password reset token", "err", err)
+		return
+	}
+
+	expiresAt := time.Now().Add(h.AccountConfig.PasswordResetTTL)
+	if err := h.DB.CreatePasswordResetToken(ctx, user.ID, auth.HashToken(token), expiresAt); err != nil {
+		slog.ErrorContext(ctx, "Error storing password reset token", "err", err)
+		return
+	}
+
+	link := h.AccountConfig.PublicURL + "/reset-password?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nWe received a request to reset your password. Use the link below to choose a new one:\n\n%s\n\n"+
+				"If you did not request this, you can ignore this email. The link expires in %s.\n",
+			user.Username, link, h.AccountConfig.PasswordResetTTL,
+		),
+	}
+
+	if err := h.Mailer.Send(msg); err != nil {
+		slog.ErrorContext(ctx, "Error sending password reset email", "err", err)
+	}
+}
+
+// resetPassword sets a new password using a token from a reset email
+func (h *UsersHandler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetRequest models.ResetPasswordRequest
+	if !decodeJSON(w, r, &resetRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(resetRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	tokenHash := auth.HashToken(resetRequest.Token)
+
+	// Look up who the token is for so the password policy can check against
+	// their username and email
+	user, err := h.DB.GetPasswordResetUser(r.Context(), tokenHash)
+	if err == nil {
+		candidate := password.Candidate{
+			Password: resetRequest.Password,
+			Username: user.Username,
+			Email:    user.Email,
+		}
+		if !h.checkPasswordPolicy(w, r, "password", candidate) {
+			return
+		}
+
+		err = h.DB.ResetPassword(r.Context(), tokenHash, resetRequest.Password)
+	}
+
+	if err != nil {
+		writeError(w, r, fmt.Errorf("resetting password: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.MessageResponse{Message: "Password has been reset"})
+}
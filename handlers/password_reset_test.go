@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"blog2/auth"
+	"blog2/db/dbtest"
+	"blog2/models"
+)
+
+func TestSendPasswordReset(t *testing.T) {
+	h, mailer := newTestUsersHandler()
+	h.DB = dbtest.Open(t)
+	ctx := context.Background()
+
+	user, err := h.DB.CreateUser(ctx, models.NewUser{Username: "johndoe", Email: "john@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	h.sendPasswordReset(ctx, user.Email)
+
+	msg, token := tokenFromMail(t, mailer, "https://blog.example.com/reset-password?token=")
+	if msg.To != user.Email {
+		t.Errorf("sent to %q, want %q", msg.To, user.Email)
+	}
+
+	resetUser, err := h.DB.GetPasswordResetUser(ctx, auth.HashToken(token))
+	if err != nil {
+		t.Fatalf("GetPasswordResetUser: %v", err)
+	}
+	if resetUser.ID != user.ID {
+		t.Errorf("token resets user %d, want %d", resetUser.ID, user.ID)
+	}
+
+	// Reset tokens are random, not signed links, so they verify nothing else
+	if _, err := auth.ValidateEmailToken(token, testJWTConfig); err == nil {
+		t.Error("reset token was accepted as an email token")
+	}
+}
+
+func TestSendPasswordResetUnknownEmail(t *testing.T) {
+	h, mailer := newTestUsersHandler()
+	h.DB = dbtest.Open(t)
+
+	h.sendPasswordReset(context.Background(), "nobody@example.com")
+
+	if msgs := mailer.Messages(); len(msgs) != 0 {
+		t.Errorf("sent %d emails for an unknown address, want none", len(msgs))
+	}
+}
@@ -3,22 +3,39 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"blog2/auth"
 	"blog2/db"
 	"blog2/models"
+	"github.com/go-playground/validator/v10"
 )
 
+// PostsConfig holds configuration for post publishing
+type PostsConfig struct {
+	RequireVerifiedEmail bool // Only users with a verified email may create posts
+}
+
+// DefaultPostsConfig returns a default posts configuration
+func DefaultPostsConfig() PostsConfig {
+	return PostsConfig{
+		RequireVerifiedEmail: false,
+	}
+}
+
 // PostsHandler handles all post-related HTTP requests
 type PostsHandler struct {
-	DB *db.DB
+	DB        *db.DB
+	Config    PostsConfig
+	Validator *validator.Validate
 }
 
 // NewPostsHandler creates a new PostsHandler
-func NewPostsHandler(db *db.DB) *PostsHandler {
-	return &PostsHandler{DB: db}
+func NewPostsHandler(db *db.DB, config PostsConfig) *PostsHandler {
+	return &PostsHandler{DB: db, Config: config, Validator: newValidator()}
 }
 
 // ServeHTTP handles all HTTP requests for posts
@@ -27,43 +44,59 @@ func (h *PostsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/posts")
 	path = strings.TrimSuffix(path, "/")
 	
+	// API keys need posts:read to read and posts:write for anything else
+	scope := auth.ScopePostsWrite
+	if r.Method == http.MethodGet {
+		scope = auth.ScopePostsRead
+	}
+	if !requireScope(w, r, scope) {
+		return
+	}
+
+	// Split /{id}/{action} paths, such as /12/reaction
+	var id int
+	var action string
+	if path != "" {
+		var idPart string
+		idPart, action, _ = strings.Cut(path[1:], "/") // Remove leading slash
+		var err error
+		id, err = strconv.Atoi(idPart)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "invalid_post_id", "Invalid post ID")
+			return
+		}
+	}
+
 	// Route based on HTTP method and path
 	switch {
 	case r.Method == http.MethodGet && path == "":
 		h.getPosts(w, r)
-	case r.Method == http.MethodGet && path != "":
-		id, err := strconv.Atoi(path[1:]) // Remove leading slash
-		if err != nil {
-			http.Error(w, "Invalid post ID", http.StatusBadRequest)
-			return
-		}
+	case r.Method == http.MethodGet && path != "" && action == "":
 		h.getPost(w, r, id)
 	case r.Method == http.MethodPost && path == "":
 		h.createPost(w, r)
-	case r.Method == http.MethodPut && path != "":
-		id, err := strconv.Atoi(path[1:]) // Remove leading slash
-		if err != nil {
-			http.Error(w, "Invalid post ID", http.StatusBadRequest)
-			return
-		}
+	case r.Method == http.MethodPut && path != "" && action == "":
 		h.updatePost(w, r, id)
-	case r.Method == http.MethodDelete && path != "":
-		id, err := strconv.Atoi(path[1:]) // Remove leading slash
-		if err != nil {
-			http.Error(w, "Invalid post ID", http.StatusBadRequest)
-			return
-		}
+	case r.Method == http.MethodDelete && path != "" && action == "":
 		h.deletePost(w, r, id)
+	case r.Method == http.MethodPut && action == "reaction":
+		h.setReaction(w, r, id)
+	case r.Method == http.MethodDelete && action == "reaction":
+		h.removeReaction(w, r, id)
+	case r.Method == http.MethodPut && action == "bookmark":
+		h.addBookmark(w, r, id)
+	case r.Method == http.MethodDelete && action == "bookmark":
+		h.removeBookmark(w, r, id)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 // getPosts returns all posts
 func (h *PostsHandler) getPosts(w http.ResponseWriter, r *http.Request) {
-	posts, err := h.DB.GetPosts()
+	posts, err := h.DB.GetPosts(r.Context(), viewerID(r))
 	if err != nil {
-		http.Error(w, "Error retrieving posts: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("retrieving posts: %w", err))
 		return
 	}
 	
@@ -73,13 +106,9 @@ func (h *PostsHandler) getPosts(w http.ResponseWriter, r *http.Request) {
 
 // getPost returns a single post by ID
 func (h *PostsHandler) getPost(w http.ResponseWriter, r *http.Request, id int) {
-	post, err := h.DB.GetPost(id)
+	post, err := h.DB.GetPost(r.Context(), id, viewerID(r))
 	if err != nil {
-		if errors.Is(err, db.ErrNotFound) {
-			http.Error(w, "Post not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error retrieving post: "+err.Error(), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("retrieving post: %w", err))
 		return
 	}
 	
@@ -89,21 +118,24 @@ func (h *PostsHandler) getPost(w http.ResponseWriter, r *http.Request, id int) {
 
 // createPost adds a new post
 func (h *PostsHandler) createPost(w http.ResponseWriter, r *http.Request) {
+	if h.Config.RequireVerifiedEmail && !h.hasVerifiedEmail(w, r) {
+		return
+	}
+
 	var newPost models.NewPost
-	if err := json.NewDecoder(r.Body).Decode(&newPost); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &newPost) {
 		return
 	}
 	
-	// Validate required fields
-	if newPost.Title == "" || newPost.Content == "" || newPost.CreatedBy == "" {
-		http.Error(w, "Title, content, and created_by are required fields", http.StatusBadRequest)
+	// Validate the input
+	if err := h.Validator.Struct(newPost); err != nil {
+		writeValidationError(w, r, err)
 		return
 	}
 	
-	post, err := h.DB.CreatePost(newPost)
+	post, err := h.DB.CreatePost(r.Context(), newPost)
 	if err != nil {
-		http.Error(w, "Error creating post: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("creating post: %w", err))
 		return
 	}
 	
@@ -115,24 +147,19 @@ func (h *PostsHandler) createPost(w http.ResponseWriter, r *http.Request) {
 // updatePost modifies an existing post
 func (h *PostsHandler) updatePost(w http.ResponseWriter, r *http.Request, id int) {
 	var updatePost models.UpdatePost
-	if err := json.NewDecoder(r.Body).Decode(&updatePost); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &updatePost) {
 		return
 	}
 	
-	// Validate required fields
-	if updatePost.Title == "" || updatePost.Content == "" {
-		http.Error(w, "Title and content are required fields", http.StatusBadRequest)
+	// Validate the input
+	if err := h.Validator.Struct(updatePost); err != nil {
+		writeValidationError(w, r, err)
 		return
 	}
 	
-	post, err := h.DB.UpdatePost(id, updatePost)
+	post, err := h.DB.UpdatePost(r.Context(), id, updatePost, viewerID(r))
 	if err != nil {
-		if errors.Is(err, db.ErrNotFound) {
-			http.Error(w, "Post not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error updating post: "+err.Error(), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("updating post: %w", err))
 		return
 	}
 	
@@ -142,15 +169,38 @@ func (h *PostsHandler) updatePost(w http.ResponseWriter, r *http.Request, id int
 
 // deletePost removes a post
 func (h *PostsHandler) deletePost(w http.ResponseWriter, r *http.Request, id int) {
-	err := h.DB.DeletePost(id)
+	err := h.DB.DeletePost(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, db.ErrNotFound) {
-			http.Error(w, "Post not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error deleting post: "+err.Error(), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("deleting post: %w", err))
 		return
 	}
 	
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// hasVerifiedEmail checks that the authenticated user has verified their email.
+// It writes an error response and returns false if they have not.
+func (h *PostsHandler) hasVerifiedEmail(w http.ResponseWriter, r *http.Request) bool {
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return false
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			writeUnauthorized(w, r)
+		} else {
+			writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		}
+		return false
+	}
+
+	if user.EmailVerifiedAt == nil {
+		writeProblem(w, r, http.StatusForbidden, "email_not_verified", "Email address must be verified before creating posts")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"blog2/auth"
+	"blog2/models"
+)
+
+// profilePath splits a /users/{username} or /users/{username}/{action} path.
+// It returns false for paths of any other shape.
+func profilePath(path string) (username string, action string, ok bool) {
+	rest, found := strings.CutPrefix(path, "/users/")
+	if !found {
+		return "", "", false
+	}
+
+	username, action, _ = strings.Cut(rest, "/")
+	if username == "" || strings.Contains(action, "/") {
+		return "", "", false
+	}
+
+	return username, action, true
+}
+
+// visibleProfile looks up the user behind a public profile. Private profiles
+// are only visible to their owner; everyone else gets a 404 as if the user
+// did not exist. It writes an error response and returns false on failure.
+func (h *UsersHandler) visibleProfile(w http.ResponseWriter, r *http.Request, username string) (models.User, bool) {
+	user, err := h.DB.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		return models.User{}, false
+	}
+
+	if user.ProfilePrivate {
+		claims, ok := auth.GetUserClaims(r)
+		if !ok || claims.UserID != user.ID {
+			writeProblem(w, r, http.StatusNotFound, "user_not_found", "User not found")
+			return models.User{}, false
+		}
+	}
+
+	return user, true
+}
+
+// getProfile returns the public profile of a user
+func (h *UsersHandler) getProfile(w http.ResponseWriter, r *http.Request, username string) {
+	user, ok := h.visibleProfile(w, r, username)
+	if !ok {
+		return
+	}
+
+	followers, following, err := h.DB.GetFollowCounts(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		return
+	}
+
+	profile := models.NewPublicProfile(user)
+	profile.FollowersCount = &followers
+	profile.FollowingCount = &following
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// getProfilePosts returns the posts written by a user
+func (h *UsersHandler) getProfilePosts(w http.ResponseWriter, r *http.Request, username string) {
+	user, ok := h.visibleProfile(w, r, username)
+	if !ok {
+		return
+	}
+
+	posts, err := h.DB.GetPostsByAuthor(r.Context(), user.Username, viewerID(r))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving posts: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
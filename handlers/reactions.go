@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"blog2/auth"
+	"blog2/models"
+)
+
+// viewerID returns the ID of the authenticated user, or 0 for anonymous
+// requests, for queries that include the viewer's reactions and bookmarks
+func viewerID(r *http.Request) int {
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		return 0
+	}
+	return claims.UserID
+}
+
+// setReaction sets the current user's reaction to a post
+func (h *PostsHandler) setReaction(w http.ResponseWriter, r *http.Request, id int) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	var reactionRequest models.ReactionRequest
+	if !decodeJSON(w, r, &reactionRequest) {
+		return
+	}
+
+	// Validate the input
+	if !models.IsReactionType(reactionRequest.Reaction) {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_reaction", "Reaction must be one of: "+strings.Join(models.ReactionTypes, ", "))
+		return
+	}
+
+	post, err := h.DB.SetReaction(r.Context(), claims.UserID, id, reactionRequest.Reaction)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("setting reaction: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+// removeReaction removes the current user's reaction to a post
+func (h *PostsHandler) removeReaction(w http.ResponseWriter, r *http.Request, id int) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	post, err := h.DB.RemoveReaction(r.Context(), claims.UserID, id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("removing reaction: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+// addBookmark saves a post to the current user's bookmarks
+func (h *PostsHandler) addBookmark(w http.ResponseWriter, r *http.Request, id int) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	if err := h.DB.AddBookmark(r.Context(), claims.UserID, id); err != nil {
+		writeError(w, r, fmt.Errorf("adding bookmark: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeBookmark removes a post from the current user's bookmarks
+func (h *PostsHandler) removeBookmark(w http.ResponseWriter, r *http.Request, id int) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	if err := h.DB.RemoveBookmark(r.Context(), claims.UserID, id); err != nil {
+		writeError(w, r, fmt.Errorf("removing bookmark: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getBookmarks returns a page of the current user's bookmarks
+func (h *UsersHandler) getBookmarks(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	before, beforeID, limit, err := pageParams(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_page_params", "Invalid cursor or limit")
+		return
+	}
+
+	bookmarks, err := h.DB.GetBookmarks(r.Context(), claims.UserID, before, beforeID, limit)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving bookmarks: %w", err))
+		return
+	}
+
+	response := models.BookmarksResponse{Bookmarks: bookmarks}
+	if len(bookmarks) == limit {
+		last := bookmarks[len(bookmarks)-1]
+		response.NextCursor = encodeCursor(last.BookmarkedAt, last.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
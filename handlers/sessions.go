@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"blog2/auth"
+)
+
+// getSessions lists the current user's active sessions
+func (h *UsersHandler) getSessions(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	sessions, err := h.DB.GetSessionsByUser(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving sessions: %w", err))
+		return
+	}
+
+	// Mark the session making this request
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// revokeSession logs out one of the current user's sessions. Revoking the
+// current session logs out the caller.
+func (h *UsersHandler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	sessionID := strings.TrimPrefix(r.URL.Path, "/users/me/sessions/")
+	if sessionID == "" || strings.Contains(sessionID, "/") {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_session_id", "Invalid session ID")
+		return
+	}
+
+	if err := h.DB.RevokeSession(r.Context(), claims.UserID, sessionID); err != nil {
+		writeError(w, r, fmt.Errorf("revoking session: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
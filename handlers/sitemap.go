@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"blog2/db"
+	"blog2/sitemap"
+)
+
+// SitemapHandler serves /sitemap.xml, the post sitemaps it indexes and
+// /robots.txt
+type SitemapHandler struct {
+	DB     *db.DB
+	Config SiteConfig
+}
+
+// NewSitemapHandler creates a new SitemapHandler
+func NewSitemapHandler(db *db.DB, config SiteConfig) *SitemapHandler {
+	return &SitemapHandler{DB: db, Config: config}
+}
+
+// ServeHTTP handles all sitemap and robots requests
+func (h *SitemapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/robots.txt":
+		h.getRobots(w, r)
+	case r.URL.Path == "/sitemap.xml":
+		h.getSitemapIndex(w, r)
+	case strings.HasPrefix(r.URL.Path, "/sitemaps/posts-") && strings.HasSuffix(r.URL.Path, ".xml"):
+		number := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/sitemaps/posts-"), ".xml")
+		page, err := strconv.Atoi(number)
+		if err != nil || page < 1 {
+			http.NotFound(w, r)
+			return
+		}
+		h.getPostsSitemap(w, r, page)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// getSitemapIndex lists one post sitemap per MaxURLs posts
+func (h *SitemapHandler) getSitemapIndex(w http.ResponseWriter, r *http.Request) {
+	dates, err := h.DB.GetSitemapPageDates(r.Context(), sitemap.MaxURLs)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("building sitemap: %w", err))
+		return
+	}
+
+	base := strings.TrimSuffix(h.Config.PublicURL, "/")
+	sitemaps := make([]sitemap.URL, 0, len(dates))
+	for i, date := range dates {
+		sitemaps = append(sitemaps, sitemap.URL{
+			Loc:     fmt.Sprintf("%s/sitemaps/posts-%d.xml", base, i+1),
+			LastMod: date,
+		})
+	}
+
+	body, err := sitemap.Index(sitemaps)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("building sitemap: %w", err))
+		return
+	}
+
+	serveCached(w, r, "application/xml; charset=utf-8", latest(sitemaps), body)
+}
+
+// getPostsSitemap lists the posts in one page of the sitemap index,
+// numbered from 1
+func (h *SitemapHandler) getPostsSitemap(w http.ResponseWriter, r *http.Request, page int) {
+	posts, err := h.DB.GetSitemapPage(r.Context(), page-1, sitemap.MaxURLs)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("building sitemap: %w", err))
+		return
+	}
+
+	if len(posts) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	base := strings.TrimSuffix(h.Config.PublicURL, "/")
+	urls := make([]sitemap.URL, 0, len(posts))
+	for _, post := range posts {
+		urls = append(urls, sitemap.URL{
+			Loc:     base + "/posts/" + strconv.Itoa(post.ID),
+			LastMod: post.DateUpdated,
+		})
+	}
+
+	body, err := sitemap.URLSet(urls)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("building sitemap: %w", err))
+		return
+	}
+
+	serveCached(w, r, "application/xml; charset=utf-8", latest(urls), body)
+}
+
+// getRobots writes robots.txt from the site configuration
+func (h *SitemapHandler) getRobots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if h.Config.RobotsDisallowAll {
+		b.WriteString("Disallow: /\n")
+	} else {
+		for _, path := range h.Config.RobotsDisallow {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+		b.WriteString("Allow: /\n")
+	}
+	b.WriteString("\nSitemap: " + strings.TrimSuffix(h.Config.PublicURL, "/") + "/sitemap.xml\n")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// latest returns the most recent LastMod of urls
+func latest(urls []sitemap.URL) (t time.Time) {
+	for _, u := range urls {
+		if u.LastMod.After(t) {
+			t = u.LastMod
+		}
+	}
+	return t
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/models"
+)
+
+// TimelineHandler serves the home timeline of posts from followed authors
+type TimelineHandler struct {
+	DB *db.DB
+}
+
+// NewTimelineHandler creates a new TimelineHandler
+func NewTimelineHandler(db *db.DB) *TimelineHandler {
+	return &TimelineHandler{DB: db}
+}
+
+// ServeHTTP handles GET /feed
+func (h *TimelineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r)
+		return
+	}
+
+	if !requireScope(w, r, auth.ScopePostsRead) {
+		return
+	}
+
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	before, beforeID, limit, err := pageParams(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_page_params", "Invalid cursor or limit")
+		return
+	}
+
+	posts, err := h.DB.GetTimeline(r.Context(), claims.UserID, before, beforeID, limit)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving timeline: %w", err))
+		return
+	}
+
+	response := models.TimelineResponse{Posts: posts}
+	if len(posts) == limit {
+		last := posts[len(posts)-1]
+		response.NextCursor = encodeCursor(last.DateCreated, last.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/models"
+)
+
+// recoveryCodeCount is the number of recovery codes issued on enrolment
+const recoveryCodeCount = 10
+
+// setupTwoFactor generates a TOTP secret for the current user after checking
+// their password. Two-factor authentication is only switched on once a code
+// is confirmed.
+func (h *UsersHandler) setupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	var setupRequest models.TwoFactorSetupRequest
+	if !decodeJSON(w, r, &setupRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(setupRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.DB.CheckPassword(r.Context(), claims.UserID, setupRequest.Password)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			writeProblem(w, r, http.StatusForbidden, "incorrect_password", "Password is incorrect")
+		} else {
+			writeError(w, r, fmt.Errorf("setting up two-factor authentication: %w", err))
+		}
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		writeProblem(w, r, http.StatusConflict, "two_factor_enabled", "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("generating secret: %w", err))
+		return
+	}
+
+	if err := h.DB.SetPendingTOTPSecret(r.Context(), user.ID, secret); err != nil {
+		writeError(w, r, fmt.Errorf("storing secret: %w", err))
+		return
+	}
+
+	response := models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(h.AccountConfig.TwoFactorIssuer, user.Username, secret),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// confirmTwoFactor enables two-factor authentication once the user proves
+// their authenticator works, and returns recovery codes
+func (h *UsersHandler) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var confirmRequest models.TwoFactorConfirmRequest
+	if !decodeJSON(w, r, &confirmRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(confirmRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		writeProblem(w, r, http.StatusConflict, "two_factor_enabled", "Two-factor authentication is already enabled")
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		writeProblem(w, r, http.StatusBadRequest, "two_factor_setup_not_started", "Two-factor setup has not been started")
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(user.TOTPSecret, confirmRequest.Code, time.Now())
+	if !valid {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_two_factor_code", "Invalid two-factor code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("generating recovery codes: %w", err))
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+
+	if err := h.DB.EnableTOTP(r.Context(), user.ID, user.TOTPSecret, step, hashes); err != nil {
+		if errors.Is(err, db.ErrTOTPSetupChanged) {
+			writeProblem(w, r, http.StatusConflict, "two_factor_setup_changed", "Two-factor setup was confirmed or restarted by another request")
+			return
+		}
+		writeError(w, r, fmt.Errorf("enabling two-factor authentication: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TwoFactorConfirmResponse{RecoveryCodes: codes})
+}
+
+// disableTwoFactor turns off two-factor authentication for the current user
+func (h *UsersHandler) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	var disableRequest models.DisableTwoFactorRequest
+	if !decodeJSON(w, r, &disableRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(disableRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	user, err := h.DB.CheckPassword(r.Context(), claims.UserID, disableRequest.Password)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			writeProblem(w, r, http.StatusForbidden, "incorrect_password", "Password is incorrect")
+		} else {
+			writeError(w, r, fmt.Errorf("disabling two-factor authentication: %w", err))
+		}
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		writeProblem(w, r, http.StatusConflict, "two_factor_not_enabled", "Two-factor authentication is not enabled")
+		return
+	}
+
+	if err := h.checkSecondFactor(r.Context(), user, disableRequest.Code, ""); err != nil {
+		writeProblem(w, r, http.StatusForbidden, "invalid_two_factor_code", "Invalid two-factor code")
+		return
+	}
+
+	if err := h.DB.DisableTOTP(r.Context(), user.ID); err != nil {
+		writeError(w, r, fmt.Errorf("disabling two-factor authentication: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loginTwoFactor exchanges a pending token and a second factor for a session token
+func (h *UsersHandler) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var loginRequest models.TwoFactorLoginRequest
+	if !decodeJSON(w, r, &loginRequest) {
+		return
+	}
+
+	// Validate the input
+	if err := h.Validator.Struct(loginRequest); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	userID, err := auth.ValidateTwoFactorPendingToken(loginRequest.PendingToken, h.JWTConfig)
+	if err != nil {
+		if errors.Is(err, auth.ErrExpiredToken) {
+			writeProblem(w, r, http.StatusUnauthorized, "login_expired", "Login has expired, please log in again")
+		} else {
+			writeProblem(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
+		}
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			writeProblem(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
+		} else {
+			writeError(w, r, fmt.Errorf("authenticating user: %w", err))
+		}
+		return
+	}
+
+	// Second factor guesses count towards the same lockout as passwords
+	ip := clientIP(r)
+	if h.checkLockout(w, r, user.Username, ip) {
+		return
+	}
+
+	if err := h.checkSecondFactor(r.Context(), user, loginRequest.Code, loginRequest.RecoveryCode); err != nil {
+		sleepContext(r, h.recordFailedLogin(r.Context(), user.Username, ip))
+		writeProblem(w, r, http.StatusUnauthorized, "invalid_two_factor_code", "Invalid two-factor code")
+		return
+	}
+	h.recordSuccessfulLogin(r.Context(), user.Username, ip)
+
+	h.writeLoginResponse(w, r, user, http.StatusOK)
+}
+
+// checkSecondFactor verifies a TOTP code or, if given instead, a recovery code
+// and marks it as used
+func (h *UsersHandler) checkSecondFactor(ctx context.Context, user models.User, code string, recoveryCode string) error {
+	if !user.TwoFactorEnabled {
+		return db.ErrInvalidCredentials
+	}
+
+	if recoveryCode != "" {
+		return h.DB.UseRecoveryCode(ctx, user.ID, auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)))
+	}
+
+	step, valid := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !valid {
+		return db.ErrInvalidCredentials
+	}
+
+	return h.DB.UseTOTPStep(ctx, user.ID, step)
+}
+
+// currentUser loads the authenticated user, writing an error response and
+// returning false if that fails
+func (h *UsersHandler) currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return models.User{}, false
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		return models.User{}, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blog2/apierror"
+	"blog2/auth"
+	"blog2/db/dbtest"
+	"blog2/models"
+)
+
+// authenticatedRequest returns a request made with a session token of user
+func authenticatedRequest(method string, target string, body string, user models.User) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	claims := models.TokenClaims{UserID: user.ID, Username: user.Username, SessionID: "test-session"}
+	return r.WithContext(context.WithValue(r.Context(), auth.UserClaimsKey, claims))
+}
+
+func TestSetupTwoFactorRequiresPassword(t *testing.T) {
+	h, _ := newTestUsersHandler()
+	h.DB = dbtest.Open(t)
+
+	user, err := h.DB.CreateUser(context.Background(), models.NewUser{Username: "johndoe", Email: "john@example.com", Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"no body", "", http.StatusBadRequest, apierror.CodeInvalidBody},
+		{"no password", `{}`, http.StatusUnprocessableEntity, apierror.CodeValidationFailed},
+		{"wrong password", `{"password": "wrong password"}`, http.StatusForbidden, "incorrect_password"},
+		{"correct password", `{"password": "correct horse battery"}`, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.setupTwoFactor(rec, authenticatedRequest(http.MethodPost, "/users/me/2fa/setup", tt.body, user))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantCode != "" {
+				var problem apierror.Problem
+				if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+					t.Fatalf("decoding problem: %v", err)
+				}
+				if problem.Code != tt.wantCode {
+					t.Errorf("code = %q, want %q", problem.Code, tt.wantCode)
+				}
+				return
+			}
+
+			var setup models.TwoFactorSetupResponse
+			if err := json.NewDecoder(rec.Body).Decode(&setup); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if setup.Secret == "" || !strings.HasPrefix(setup.ProvisioningURI, "otpauth://totp/") {
+				t.Errorf("response = %+v, want a secret and provisioning URI", setup)
+			}
+		})
+	}
+}
@@ -1,118 +1,303 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"blog2/auth"
 	"blog2/db"
+	"blog2/mail"
+	"blog2/metrics"
 	"blog2/models"
+	"blog2/password"
+	"github.com/go-playground/validator/v10"
 )
 
+// AccountConfig holds configuration for account management flows
+type AccountConfig struct {
+	PublicURL        string        // Base URL used to build links in emails
+	PasswordResetTTL time.Duration // How long a password reset token stays valid
+
+	VerificationTTL            time.Duration // How long an email verification link stays valid
+	VerificationResendInterval time.Duration // Minimum time between verification emails
+
+	DeletedPostsPolicy DeletedPostsPolicy // What happens to a user's posts when they delete their account
+	PostsReassignTo    string             // Author that posts are handed to under PostsReassign
+
+	Lockout LockoutConfig // Brute-force protection for login
+
+	TwoFactorIssuer     string        // Issuer name shown in authenticator apps
+	TwoFactorPendingTTL time.Duration // How long a user has to enter their second factor
+
+	PasswordPolicy password.PolicyConfig // Requirements for new passwords
+}
+
+// DeletedPostsPolicy controls what happens to posts when their author deletes their account
+type DeletedPostsPolicy string
+
+// Supported policies for posts of deleted accounts
+const (
+	PostsAnonymize DeletedPostsPolicy = "anonymize" // Attribute posts to AnonymousAuthor
+	PostsReassign  DeletedPostsPolicy = "reassign"  // Attribute posts to AccountConfig.PostsReassignTo
+)
+
+// AnonymousAuthor is shown as the author of posts whose account was deleted
+const AnonymousAuthor = "[deleted]"
+
+// DefaultAccountConfig returns a default account configuration
+func DefaultAccountConfig() AccountConfig {
+	return AccountConfig{
+		PublicURL:        "http://localhost:8080",
+		PasswordResetTTL: time.Hour,
+
+		VerificationTTL:            48 * time.Hour,
+		VerificationResendInterval: 5 * time.Minute,
+
+		DeletedPostsPolicy: PostsAnonymize,
+
+		Lockout: DefaultLockoutConfig(),
+
+		TwoFactorIssuer:     "Blog API",
+		TwoFactorPendingTTL: 5 * time.Minute,
+
+		PasswordPolicy: password.DefaultPolicyConfig(),
+	}
+}
+
 // UsersHandler handles all user-related HTTP requests
 type UsersHandler struct {
-	DB        *db.DB
-	Validator *validator.Validate
-	JWTConfig auth.JWTConfig
+	DB             *db.DB
+	Validator      *validator.Validate
+	JWTConfig      auth.JWTConfig
+	AccountConfig  AccountConfig
+	Mailer         mail.Mailer
+	PasswordPolicy *password.Policy
+	Metrics        *metrics.Metrics // Optional
 }
 
 // NewUsersHandler creates a new UsersHandler
-func NewUsersHandler(db *db.DB, jwtConfig auth.JWTConfig) *UsersHandler {
+func NewUsersHandler(db *db.DB, jwtConfig auth.JWTConfig, accountConfig AccountConfig, mailer mail.Mailer, passwordPolicy *password.Policy) *UsersHandler {
 	return &UsersHandler{
-		DB:        db,
-		Validator: validator.New(),
-		JWTConfig: jwtConfig,
+		DB:             db,
+		Validator:      newValidator(),
+		JWTConfig:      jwtConfig,
+		AccountConfig:  accountConfig,
+		Mailer:         mailer,
+		PasswordPolicy: passwordPolicy,
 	}
 }
 
 // ServeHTTP handles all HTTP requests for users
 func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Public profiles are served for any /users/{username} path that is not
+	// one of the fixed routes below; reserved usernames keep them apart
+	username, action, isProfile := profilePath(r.URL.Path)
+	if isProfile && models.IsReservedUsername(username) {
+		isProfile = false
+	}
+
+	// API keys may read the profile but never manage the account. Public
+	// profiles need no scope to read, but following someone acts for the
+	// account.
+	scope := auth.ScopeAccount
+	if r.Method == http.MethodGet && r.URL.Path == "/users/me" {
+		scope = auth.ScopeProfileRead
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/users/me/bookmarks" {
+		scope = auth.ScopePostsRead
+	}
+	if (!isProfile || r.Method != http.MethodGet) && !requireScope(w, r, scope) {
+		return
+	}
+
 	// Route based on HTTP method and path
 	switch {
 	case r.Method == http.MethodPost && r.URL.Path == "/users/register":
 		h.registerUser(w, r)
 	case r.Method == http.MethodPost && r.URL.Path == "/users/login":
 		h.loginUser(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/login/2fa":
+		h.loginTwoFactor(w, r)
 	case r.Method == http.MethodGet && r.URL.Path == "/users/me":
 		h.getCurrentUser(w, r)
+	case r.Method == http.MethodPatch && r.URL.Path == "/users/me":
+		h.updateCurrentUser(w, r)
+	case r.Method == http.MethodDelete && r.URL.Path == "/users/me":
+		h.deleteCurrentUser(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/me/password":
+		h.changePassword(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/me/email":
+		h.changeEmail(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/me/2fa/setup":
+		h.setupTwoFactor(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/me/2fa/confirm":
+		h.confirmTwoFactor(w, r)
+	case r.Method == http.MethodDelete && r.URL.Path == "/users/me/2fa":
+		h.disableTwoFactor(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/me/api-keys":
+		h.createAPIKey(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/users/me/api-keys":
+		h.getAPIKeys(w, r)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/users/me/api-keys/"):
+		h.revokeAPIKey(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/users/me/bookmarks":
+		h.getBookmarks(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/users/me/sessions":
+		h.getSessions(w, r)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/users/me/sessions/"):
+		h.revokeSession(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/users/verify":
+		h.verifyEmail(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/me/verify/resend":
+		h.resendVerification(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/password/forgot":
+		h.forgotPassword(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/users/password/reset":
+		h.resetPassword(w, r)
+	case r.Method == http.MethodGet && isProfile && action == "":
+		h.getProfile(w, r, username)
+	case r.Method == http.MethodGet && isProfile && action == "posts":
+		h.getProfilePosts(w, r, username)
+	case r.Method == http.MethodGet && isProfile && action == "followers":
+		h.getFollowers(w, r, username)
+	case r.Method == http.MethodGet && isProfile && action == "following":
+		h.getFollowing(w, r, username)
+	case r.Method == http.MethodPost && isProfile && action == "follow":
+		h.follow(w, r, username)
+	case r.Method == http.MethodDelete && isProfile && action == "follow":
+		h.unfollow(w, r, username)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r)
 	}
 }
 
 // registerUser handles user registration
 func (h *UsersHandler) registerUser(w http.ResponseWriter, r *http.Request) {
 	var newUser models.NewUser
-	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &newUser) {
 		return
 	}
 
 	// Validate the input
 	if err := h.Validator.Struct(newUser); err != nil {
-		http.Error(w, "Validation error: "+err.Error(), http.StatusBadRequest)
+		writeValidationError(w, r, err)
 		return
 	}
 
-	// Create the user
-	user, err := h.DB.CreateUser(newUser)
-	if err != nil {
-		if errors.Is(err, db.ErrUserAlreadyExists) {
-			http.Error(w, "Username or email already exists", http.StatusConflict)
-		} else {
-			http.Error(w, "Error creating user: "+err.Error(), http.StatusInternalServerError)
-		}
+	// Check the password against the password policy
+	candidate := password.Candidate{
+		Password: newUser.Password,
+		Username: newUser.Username,
+		Email:    newUser.Email,
+	}
+	if !h.checkPasswordPolicy(w, r, "password", candidate) {
 		return
 	}
 
-	// Generate a token for the new user
-	token, err := auth.GenerateToken(user, h.JWTConfig)
+	// Create the user
+	user, err := h.DB.CreateUser(r.Context(), newUser)
 	if err != nil {
-		http.Error(w, "Error generating token: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("creating user: %w", err))
 		return
 	}
 
-	// Return the user and token
-	response := models.LoginResponse{
-		Token: token,
-		User:  user,
-	}
+	// Ask the user to confirm their address
+	go h.sendVerificationEmail(context.WithoutCancel(r.Context()), user)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	// Return the user and a token for the new user
+	h.writeLoginResponse(w, r, user, http.StatusCreated)
 }
 
 // loginUser handles user login
 func (h *UsersHandler) loginUser(w http.ResponseWriter, r *http.Request) {
 	var loginRequest models.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &loginRequest) {
 		return
 	}
 
 	// Validate the input
 	if err := h.Validator.Struct(loginRequest); err != nil {
-		http.Error(w, "Validation error: "+err.Error(), http.StatusBadRequest)
+		writeValidationError(w, r, err)
+		return
+	}
+
+	// Refuse to check credentials while the account or IP is locked out
+	ip := clientIP(r)
+	if h.checkLockout(w, r, loginRequest.Username, ip) {
 		return
 	}
 
 	// Authenticate the user
-	user, err := h.DB.AuthenticateUser(loginRequest)
+	user, err := h.DB.AuthenticateUser(r.Context(), loginRequest)
 	if err != nil {
 		if errors.Is(err, db.ErrInvalidCredentials) {
-			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+			sleepContext(r, h.recordFailedLogin(r.Context(), loginRequest.Username, ip))
+			writeProblem(w, r, http.StatusUnauthorized, "invalid_credentials", "Invalid username or password")
 		} else {
-			http.Error(w, "Error authenticating user: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, r, fmt.Errorf("authenticating user: %w", err))
 		}
 		return
 	}
+	h.recordSuccessfulLogin(r.Context(), user.Username, ip)
+
+	h.completeLogin(w, r, user)
+}
+
+// completeLogin finishes a login whose first factor has been checked. Users
+// with two-factor authentication get a pending token to exchange at
+// /users/login/2fa; everyone else gets a session token straight away.
+func (h *UsersHandler) completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	if !user.TwoFactorEnabled {
+		h.writeLoginResponse(w, r, user, http.StatusOK)
+		return
+	}
+
+	pendingToken, err := auth.GenerateTwoFactorPendingToken(user.ID, h.AccountConfig.TwoFactorPendingTTL, h.JWTConfig)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("generating token: %w", err))
+		return
+	}
 
+	response := models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		PendingToken:      pendingToken,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeLoginResponse starts a new session for user and writes its token
+// together with the user
+func (h *UsersHandler) writeLoginResponse(w http.ResponseWriter, r *http.Request, user models.User, status int) {
+	sessionID, err := auth.GenerateSessionID()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("creating session: %w", err))
+		return
+	}
+
+	// The session lives exactly as long as the token bound to it
+	expiresAt := time.Now().Add(h.JWTConfig.TokenDuration)
+	if _, err := h.DB.CreateSession(r.Context(), sessionID, user.ID, r.UserAgent(), clientIP(r), expiresAt); err != nil {
+		writeError(w, r, fmt.Errorf("creating session: %w", err))
+		return
+	}
+
+	h.writeSessionToken(w, r, user, sessionID, status)
+}
+
+// writeSessionToken generates a token for an existing session and writes it
+// together with the user
+func (h *UsersHandler) writeSessionToken(w http.ResponseWriter, r *http.Request, user models.User, sessionID string, status int) {
 	// Generate a token
-	token, err := auth.GenerateToken(user, h.JWTConfig)
+	token, err := auth.GenerateToken(user, sessionID, h.JWTConfig)
 	if err != nil {
-		http.Error(w, "Error generating token: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("generating token: %w", err))
 		return
 	}
 
@@ -123,6 +308,7 @@ func (h *UsersHandler) loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -131,18 +317,14 @@ func (h *UsersHandler) getCurrentUser(w http.ResponseWriter, r *http.Request) {
 	// Get the user claims from the context
 	claims, ok := auth.GetUserClaims(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeUnauthorized(w, r)
 		return
 	}
 
 	// Get the user from the database
-	user, err := h.DB.GetUserByID(claims.UserID)
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
 	if err != nil {
-		if errors.Is(err, db.ErrUserNotFound) {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error retrieving user: "+err.Error(), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
 		return
 	}
 
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blog2/apierror"
+	"blog2/models"
+)
+
+// emailOfLength returns a valid email address exactly length characters long
+func emailOfLength(length int) string {
+	const domain = "@example.com"
+	return strings.Repeat("a", length-len(domain)) + domain
+}
+
+func TestEmailLength(t *testing.T) {
+	// users.email is VARCHAR(100), so longer addresses must be rejected as
+	// invalid input instead of failing in the database
+	h, _ := newTestUsersHandler()
+
+	longest := emailOfLength(100)
+	if err := h.Validator.Struct(models.NewUser{Username: "johndoe", Email: longest, Password: "x"}); err != nil {
+		t.Errorf("100 character email rejected: %v", err)
+	}
+
+	tooLong := emailOfLength(101)
+	user := models.User{ID: 42, Username: "johndoe"}
+	tests := []struct {
+		name    string
+		serve   func(w http.ResponseWriter, r *http.Request)
+		request *http.Request
+	}{
+		{"register", h.registerUser, httptest.NewRequest(http.MethodPost, "/users/register", strings.NewReader(`{"username":"johndoe","email":"`+tooLong+`","password":"correct horse battery"}`))},
+		{"forgot password", h.forgotPassword, httptest.NewRequest(http.MethodPost, "/users/password/forgot", strings.NewReader(`{"email":"`+tooLong+`"}`))},
+		{"change email", h.changeEmail, authenticatedRequest(http.MethodPost, "/users/me/email", `{"email":"`+tooLong+`","password":"correct horse battery"}`, user)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.serve(rec, tt.request)
+
+			assertProblem(t, rec, http.StatusUnprocessableEntity, apierror.CodeValidationFailed)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"blog2/apierror"
+	"blog2/models"
+	"github.com/go-playground/validator/v10"
+)
+
+// newValidator creates a validator with the custom tags used by the models
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	// Report fields by the names clients use in JSON
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	// username: safe in URL paths and not reserved for routes under /users/
+	v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return models.IsValidUsername(fl.Field().String())
+	})
+
+	return v
+}
+
+// writeValidationError writes a 422 response listing every field that
+// failed validation
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		writeError(w, r, err)
+		return
+	}
+
+	fields := make([]apierror.FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields = append(fields, apierror.FieldError{
+			Field:   fieldPath(fe),
+			Code:    validationCode(fe.Tag()),
+			Message: validationMessage(fe),
+		})
+	}
+
+	apierror.Write(w, r, apierror.New(http.StatusUnprocessableEntity, apierror.CodeValidationFailed,
+		"Request body failed validation").WithFields(fields))
+}
+
+// fieldPath returns the JSON path of a field, without the struct name
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+// validationMessage describes a failed validation rule in plain words
+func validationMessage(fe validator.FieldError) string {
+	unit := "characters"
+	if k := fe.Kind(); k == reflect.Slice || k == reflect.Array || k == reflect.Map {
+		unit = "items"
+	}
+
+	switch validationCode(fe.Tag()) {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "is required unless " + snakeCase(fe.Param()) + " is given"
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be an http or https URL"
+	case "username":
+		return "may only use letters, digits, '_', '.' and '-', and must not be reserved"
+	case "min":
+		return fmt.Sprintf("must be at least %s %s", fe.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s %s", fe.Param(), unit)
+	case "len":
+		return fmt.Sprintf("must be exactly %s %s", fe.Param(), unit)
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "numeric":
+		return "must only contain digits"
+	default:
+		return "is invalid"
+	}
+}
+
+// validationCode returns the rule reported for a failed tag. For
+// alternatives such as "len=0|http_url", which allows clearing a URL, it is
+// the last one.
+func validationCode(tag string) string {
+	if i := strings.LastIndex(tag, "|"); i >= 0 {
+		tag = tag[i+1:]
+	}
+	name, _, _ := strings.Cut(tag, "=")
+	return name
+}
+
+// snakeCase converts a Go field name such as RecoveryCode to its JSON name
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"blog2/auth"
+	"blog2/db"
+	"blog2/mail"
+	"blog2/models"
+)
+
+// verifyEmail confirms an email address using the token from a verification link
+func (h *UsersHandler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	tokenString := r.URL.Query().Get("token")
+	if tokenString == "" {
+		writeProblem(w, r, http.StatusBadRequest, "verification_token_required", "Verification token required")
+		return
+	}
+
+	claims, err := auth.ValidateEmailToken(tokenString, h.JWTConfig)
+	if err != nil {
+		if errors.Is(err, auth.ErrExpiredToken) {
+			writeProblem(w, r, http.StatusBadRequest, "verification_link_expired", "Verification link has expired")
+		} else {
+			writeProblem(w, r, http.StatusBadRequest, "invalid_verification_link", "Invalid verification link")
+		}
+		return
+	}
+
+	var user models.User
+	if claims.Purpose == auth.PurposeEmailChange {
+		user, err = h.DB.ChangeEmail(r.Context(), claims.UserID, claims.PreviousEmail, claims.PasswordStamp, claims.Email)
+	} else {
+		user, err = h.DB.MarkEmailVerified(r.Context(), claims.UserID, claims.Email)
+	}
+
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			// The account is gone or its email or password has changed since the
+			// link was sent
+			writeProblem(w, r, http.StatusBadRequest, "invalid_verification_link", "Invalid verification link")
+		} else if errors.Is(err, db.ErrUserAlreadyExists) {
+			writeProblem(w, r, http.StatusConflict, "email_in_use", "Email is already in use by another account")
+		} else {
+			writeError(w, r, fmt.Errorf("verifying email: %w", err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// resendVerification sends a new verification email to the current user
+func (h *UsersHandler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	// Get the user claims from the context
+	claims, ok := auth.GetUserClaims(r)
+	if !ok {
+		writeUnauthorized(w, r)
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("retrieving user: %w", err))
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		writeProblem(w, r, http.StatusConflict, "email_already_verified", "Email is already verified")
+		return
+	}
+
+	if err := h.DB.ClaimVerificationSend(r.Context(), user.ID, h.AccountConfig.VerificationResendInterval); err != nil {
+		if errors.Is(err, db.ErrVerificationThrottled) {
+			retryAfter := int(h.AccountConfig.VerificationResendInterval.Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeProblem(w, r, http.StatusTooManyRequests, "verification_throttled", "Verification email sent too recently, try again later")
+		} else {
+			writeError(w, r, fmt.Errorf("sending verification email: %w", err))
+		}
+		return
+	}
+
+	if err := h.mailVerificationLink(user, user.Email, auth.PurposeEmailVerification); err != nil {
+		writeError(w, r, fmt.Errorf("sending verification email: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(models.MessageResponse{Message: "Verification email sent"})
+}
+
+// sendVerificationEmail sends the initial verification email after registration.
+// Failures are logged since the client has already been answered.
+func (h *UsersHandler) sendVerificationEmail(ctx context.Context, user models.User) {
+	if err := h.DB.ClaimVerificationSend(ctx, user.ID, h.AccountConfig.VerificationResendInterval); err != nil {
+		slog.ErrorContext(ctx, "Error recording verification email", "err", err)
+		return
+	}
+
+	if err := h.mailVerificationLink(user, user.Email, auth.PurposeEmailVerification); err != nil {
+		slog.ErrorContext(ctx, "Error sending verification email", "err", err)
+	}
+}
+
+// mailVerificationLink emails a signed link proving that user owns email
+func (h *UsersHandler) mailVerificationLink(user models.User, email string, purpose string) error {
+	token, err := auth.GenerateEmailToken(user, email, purpose, h.AccountConfig.VerificationTTL, h.JWTConfig)
+	if err != nil {
+		return err
+	}
+
+	link := h.AccountConfig.PublicURL + "/users/verify?token=" + url.QueryEscape(token)
+	return h.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+				"The link expires in %s.\n",
+			user.Username, link, h.AccountConfig.VerificationTTL,
+		),
+	})
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"blog2/apierror"
+	"blog2/auth"
+	"blog2/db"
+	"blog2/db/dbtest"
+	"blog2/mail"
+	"blog2/models"
+)
+
+// testJWTConfig signs tokens in tests
+var testJWTConfig = auth.JWTConfig{SecretKey: "test-secret-key-that-is-long-enough", TokenDuration: auth.DefaultJWTConfig().TokenDuration}
+
+// newTestUsersHandler returns a handler that records mail in memory
+func newTestUsersHandler() (*UsersHandler, *mail.MemoryMailer) {
+	mailer := mail.NewMemoryMailer()
+	config := DefaultAccountConfig()
+	config.PublicURL = "https://blog.example.com"
+	return NewUsersHandler(nil, testJWTConfig, config, mailer, nil), mailer
+}
+
+// tokenFromMail returns the token of the link starting with prefix in the
+// last message sent, failing the test if there is none
+func tokenFromMail(t *testing.T, mailer *mail.MemoryMailer, prefix string) (mail.Message, string) {
+	t.Helper()
+
+	msg, ok := mailer.Last()
+	if !ok {
+		t.Fatal("no email was sent")
+	}
+
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		link, err := url.Parse(line)
+		if err != nil {
+			t.Fatalf("parsing link %q: %v", line, err)
+		}
+
+		token := link.Query().Get("token")
+		if token == "" {
+			t.Fatalf("link %q has no token", line)
+		}
+		return msg, token
+	}
+
+	t.Fatalf("email body has no link starting with %q:\n%s", prefix, msg.Body)
+	return mail.Message{}, ""
+}
+
+func TestMailVerificationLink(t *testing.T) {
+	user := models.User{ID: 42, Username: "johndoe", Email: "john@example.com", PasswordHash: "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$a2V5"}
+
+	tests := []struct {
+		name    string
+		email   string
+		purpose string
+	}{
+		{"verification", user.Email, auth.PurposeEmailVerification},
+		{"email change", "new@example.com", auth.PurposeEmailChange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mailer := newTestUsersHandler()
+
+			if err := h.mailVerificationLink(user, tt.email, tt.purpose); err != nil {
+				t.Fatalf("mailVerificationLink: %v", err)
+			}
+
+			msg, token := tokenFromMail(t, mailer, "https://blog.example.com/users/verify?token=")
+			if msg.To != tt.email {
+				t.Errorf("sent to %q, want %q", msg.To, tt.email)
+			}
+
+			claims, err := auth.ValidateEmailToken(token, testJWTConfig)
+			if err != nil {
+				t.Fatalf("ValidateEmailToken: %v", err)
+			}
+			if claims.Purpose != tt.purpose {
+				t.Errorf("purpose = %q, want %q", claims.Purpose, tt.purpose)
+			}
+			if claims.UserID != user.ID || claims.Email != tt.email {
+				t.Errorf("claims = %+v, want user %d and email %q", claims, user.ID, tt.email)
+			}
+
+			if tt.purpose == auth.PurposeEmailChange {
+				if claims.PreviousEmail != user.Email || claims.PasswordStamp != auth.PasswordStamp(user.PasswordHash) {
+					t.Errorf("claims = %+v, want previous email %q and the current password stamp", claims, user.Email)
+				}
+			}
+
+			// A signed link must never work as a session token
+			if _, err := auth.ValidateToken(token, testJWTConfig); err == nil {
+				t.Error("verification token was accepted as a session token")
+			}
+		})
+	}
+}
+
+func TestVerifyEmailChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     func(ctx context.Context, database *db.DB, user models.User) error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "unchanged",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "password changed",
+			before: func(ctx context.Context, database *db.DB, user models.User) error {
+				return database.SetPassword(ctx, user.ID, "a different password")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_verification_link",
+		},
+		{
+			name: "email changed",
+			before: func(ctx context.Context, database *db.DB, user models.User) error {
+				_, err := database.ChangeEmail(ctx, user.ID, user.Email, auth.PasswordStamp(user.PasswordHash), "other@example.com")
+				return err
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_verification_link",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mailer := newTestUsersHandler()
+			h.DB = dbtest.Open(t)
+			ctx := context.Background()
+
+			user, err := h.DB.CreateUser(ctx, models.NewUser{Username: "johndoe", Email: "john@example.com", Password: "correct horse battery"})
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			if err := h.mailVerificationLink(user, "new@example.com", auth.PurposeEmailChange); err != nil {
+				t.Fatalf("mailVerificationLink: %v", err)
+			}
+			_, token := tokenFromMail(t, mailer, "https://blog.example.com/users/verify?token=")
+
+			if tt.before != nil {
+				if err := tt.before(ctx, h.DB, user); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			h.verifyEmail(rec, httptest.NewRequest(http.MethodGet, "/users/verify?token="+url.QueryEscape(token), nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantCode != "" {
+				var problem apierror.Problem
+				if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+					t.Fatalf("decoding problem: %v", err)
+				}
+				if problem.Code != tt.wantCode {
+					t.Errorf("code = %q, want %q", problem.Code, tt.wantCode)
+				}
+				return
+			}
+
+			changed, err := h.DB.GetUserByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("GetUserByID: %v", err)
+			}
+			if changed.Email != "new@example.com" {
+				t.Errorf("email = %q, want new@example.com", changed.Email)
+			}
+		})
+	}
+}
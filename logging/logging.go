@@ -0,0 +1,116 @@
+// Package logging sets up structured logging with log/slog. Records logged
+// with a request's context carry its request ID and the user it was
+// authenticated as, so every line about a request can be found by either.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"blog2/requestid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// New returns a logger writing records at level and above to w in format
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel parses a level name such as "debug", "info", "warn" or "error"
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", level)
+	}
+	return lvl, nil
+}
+
+// contextHandler adds the request ID, user and trace in the context to each
+// record
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the request attributes of ctx to r and passes it on
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if userID := UserFromContext(ctx); userID != 0 {
+		r.AddAttrs(slog.Int("user_id", userID))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler that keeps adding request attributes
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a handler that keeps adding request attributes
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestInfo holds what is learned about a request while it is handled.
+// The access log middleware creates it before authentication runs, so it
+// is shared by pointer and updated in place.
+type requestInfo struct {
+	userID atomic.Int64
+}
+
+// contextKey is the type of the context key holding the request info
+type contextKey struct{}
+
+// newContext returns a copy of ctx carrying info
+func newContext(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// SetUser records the user a request is authenticated as, for the request's
+// log records and its access log line. It does nothing for contexts that
+// didn't come through Middleware.
+func SetUser(ctx context.Context, userID int) {
+	if info, ok := ctx.Value(contextKey{}).(*requestInfo); ok {
+		info.userID.Store(int64(userID))
+	}
+}
+
+// UserFromContext returns the user recorded with SetUser, or 0 if there is
+// none
+func UserFromContext(ctx context.Context) int {
+	if info, ok := ctx.Value(contextKey{}).(*requestInfo); ok {
+		return int(info.userID.Load())
+	}
+	return 0
+}
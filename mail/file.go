@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileMailer appends messages as JSON lines to a file instead of sending them.
+// It is intended for local development and tests, where the file can be
+// inspected to pick up links such as password reset tokens.
+type FileMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileMailer creates a new FileMailer writing to path
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{Path: path}
+}
+
+// Send appends the message to the file
+func (m *FileMailer) Send(msg Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
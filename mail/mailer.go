@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"errors"
+)
+
+var (
+	ErrNoRecipient = errors.New("message has no recipient")
+)
+
+// Message represents a plain-text email
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer is implemented by anything that can deliver an email message
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// validate checks that a message can be delivered
+func validate(msg Message) error {
+	if msg.To == "" {
+		return ErrNoRecipient
+	}
+	return nil
+}
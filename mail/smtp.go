@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds configuration for an SMTP relay
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer delivers messages through an SMTP relay
+type SMTPMailer struct {
+	Config SMTPConfig
+}
+
+// NewSMTPMailer creates a new SMTPMailer
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{Config: config}
+}
+
+// Send delivers a message through the configured relay
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.Config.Host, strconv.Itoa(m.Config.Port))
+
+	// Only authenticate when credentials are configured
+	var auth smtp.Auth
+	if m.Config.Username != "" {
+		auth = smtp.PlainAuth("", m.Config.Username, m.Config.Password, m.Config.Host)
+	}
+
+	if err := smtp.SendMail(addr, auth, m.Config.From, []string{msg.To}, m.build(msg)); err != nil {
+		return fmt.Errorf("sending mail via %s: %w", addr, err)
+	}
+
+	return nil
+}
+
+// build renders the message headers and body in RFC 5322 format
+func (m *SMTPMailer) build(msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + m.Config.From + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
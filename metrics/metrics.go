@@ -0,0 +1,143 @@
+// Package metrics collects Prometheus metrics about HTTP requests, the
+// database connection pool, logins and the Go runtime, and serves them for
+// scraping.
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blog2/apierror"
+	"blog2/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of the application's own metrics
+const namespace = "blog"
+
+// Login results
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// Metrics holds the collectors of the server. A nil *Metrics is valid and
+// records nothing, so handlers work without metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+	routes   *Routes
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	logins          *prometheus.CounterVec
+	lockouts        *prometheus.CounterVec
+}
+
+// New registers the collectors for requests to routes, the connection pool
+// of db, logins and the Go runtime
+func New(db *sql.DB, routes *Routes) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		routes:   routes,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Password and two-factor login attempts, by result.",
+		}, []string{"result"}),
+		lockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_lockouts_total",
+			Help:      "Lockouts after repeated failed logins, by scope.",
+		}, []string{"scope"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.logins,
+		m.lockouts,
+		collectors.NewDBStatsCollector(db, "blog"),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Middleware counts and times requests by their route template
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := logging.NewResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		method, route := methodLabel(r.Method), m.routes.Match(r.URL.Path)
+		m.requests.WithLabelValues(method, route, strconv.Itoa(rw.Status())).Inc()
+		m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel returns the method label for a request, folding methods the
+// API doesn't use into "OTHER" for the same reason as OtherRoute
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format. If token is not
+// empty, scrapers must send it as a bearer token.
+func (m *Metrics) Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return metrics
+	}
+
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "A valid metrics token is required"))
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// Login records the result of a login attempt
+func (m *Metrics) Login(result string) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(result).Inc()
+}
+
+// Lockout records a lockout in scope
+func (m *Metrics) Lockout(scope string) {
+	if m == nil {
+		return
+	}
+	m.lockouts.WithLabelValues(scope).Inc()
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import "strings"
+
+// OtherRoute is reported for paths that match no known route, so that
+// scanners probing random paths can't create unbounded label values
+const OtherRoute = "other"
+
+// Routes maps request paths to route templates such as /posts/{id}, so that
+// requests to different posts are counted together
+type Routes struct {
+	templates [][]string // Split on "/"
+}
+
+// NewRoutes returns the routes for templates. A segment in braces, such as
+// {id}, matches any single path segment.
+func NewRoutes(templates ...string) *Routes {
+	routes := &Routes{}
+	for _, template := range templates {
+		routes.templates = append(routes.templates, strings.Split(template, "/"))
+	}
+	return routes
+}
+
+// Match returns the template matching path, or OtherRoute. When several
+// match, the one with the most literal segments wins, so /users/me is
+// preferred to /users/{username}.
+func (r *Routes) Match(path string) string {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if path == "/" {
+		segments = []string{"", ""}
+	}
+
+	best, bestLiterals := OtherRoute, -1
+	for _, template := range r.templates {
+		literals, ok := matchTemplate(template, segments)
+		if ok && literals > bestLiterals {
+			best, bestLiterals = strings.Join(template, "/"), literals
+		}
+	}
+
+	return best
+}
+
+// matchTemplate reports whether segments match template and how many of the
+// template's segments are literals
+func matchTemplate(template []string, segments []string) (int, bool) {
+	if len(template) != len(segments) {
+		return 0, false
+	}
+
+	literals := 0
+	for i, part := range template {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return 0, false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return 0, false
+		}
+		literals++
+	}
+
+	return literals, true
+}
@@ -0,0 +1,173 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// numbered returns up and down scripts for versions 1 to n
+func numbered(n int) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for v := 1; v <= n; v++ {
+		fsys[fmt.Sprintf("%d_step%d.up.sql", v, v)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("CREATE TABLE t%d ()", v))}
+		fsys[fmt.Sprintf("%d_step%d.down.sql", v, v)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("DROP TABLE t%d", v))}
+	}
+	return fsys
+}
+
+// file returns a MapFS file holding sql
+func file(sql string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(sql)}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name         string
+		fsys         fstest.MapFS
+		wantVersions []int
+		wantErr      string // Part of the error message, if Load should fail
+	}{
+		{"empty", fstest.MapFS{}, []int{}, ""},
+		{"sorted by number, not name", numbered(11), []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, ""},
+		{"leading zeros", fstest.MapFS{"01_a.up.sql": file("A"), "002_b.up.sql": file("B")}, []int{1, 2}, ""},
+		{"down script optional", fstest.MapFS{"01_a.up.sql": file("A"), "02_b.up.sql": file("B"), "02_b.down.sql": file("-B")}, []int{1, 2}, ""},
+		{
+			name: "other files ignored",
+			fsys: fstest.MapFS{
+				"01_a.up.sql":      file("A"),
+				"migrations.go":    file("package migrations"),
+				"README.md":        file("docs"),
+				"02_b.sql":         file("no direction"),
+				"02-b.up.sql":      file("bad separator"),
+				"x_b.up.sql":       file("no version"),
+				"02_b.up.sql.orig": file("backup"),
+				"sub/02_b.up.sql":  file("in a subdirectory"),
+				"04_d-e.up.sql":    file("bad name"),
+				"05_f.UP.SQL":      file("upper case"),
+			},
+			wantVersions: []int{1},
+		},
+		{"missing up script", fstest.MapFS{"01_a.up.sql": file("A"), "02_b.down.sql": file("-B")}, nil, "migration 2_b has no up script"},
+		{"empty up script", fstest.MapFS{"01_a.up.sql": file("")}, nil, "migration 1_a has no up script"},
+		{"two names", fstest.MapFS{"01_a.up.sql": file("A"), "01_b.down.sql": file("-B")}, nil, "migration 1 has two names"},
+		{"duplicate up script", fstest.MapFS{"1_a.up.sql": file("A"), "01_a.up.sql": file("A")}, nil, "migration 1 has two up scripts"},
+		{"duplicate down script", fstest.MapFS{"1_a.up.sql": file("A"), "1_a.down.sql": file("-A"), "001_a.down.sql": file("-A")}, nil, "migration 1 has two down scripts"},
+		{"gap", fstest.MapFS{"01_a.up.sql": file("A"), "03_c.up.sql": file("C")}, nil, "migration 2 is missing before 3_c"},
+		{"first version missing", fstest.MapFS{"02_b.up.sql": file("B")}, nil, "migration 1 is missing before 2_b"},
+		{"version zero", fstest.MapFS{"00_a.up.sql": file("A"), "01_b.up.sql": file("B")}, nil, "versions start at 1"},
+		{"version too large", fstest.MapFS{"99999999999999999999_a.up.sql": file("A")}, nil, "versions start at 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.fsys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			versions := make([]int, len(migrations))
+			for i, m := range migrations {
+				versions[i] = m.Version
+			}
+			if !reflect.DeepEqual(versions, tt.wantVersions) {
+				t.Errorf("versions = %v, want %v", versions, tt.wantVersions)
+			}
+		})
+	}
+}
+
+func TestLoadContents(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"01_create_posts.up.sql":   file("CREATE TABLE posts ()"),
+		"01_create_posts.down.sql": file("DROP TABLE posts"),
+		"02_add_index.up.sql":      file("CREATE INDEX ON posts (id)"),
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("CREATE TABLE posts ()"))
+	want := []Migration{
+		{Version: 1, Name: "create_posts", Up: "CREATE TABLE posts ()", Down: "DROP TABLE posts", Checksum: hex.EncodeToString(sum[:])},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX ON posts (id)", Checksum: migrations[1].Checksum},
+	}
+	if !reflect.DeepEqual(migrations, want) {
+		t.Errorf("Load = %+v, want %+v", migrations, want)
+	}
+
+	// The checksum covers the up script only
+	changed, err := Load(fstest.MapFS{
+		"01_create_posts.up.sql":   file("CREATE TABLE posts ()"),
+		"01_create_posts.down.sql": file("DROP TABLE IF EXISTS posts"),
+		"02_add_index.up.sql":      file("CREATE INDEX ON posts (id, title)"),
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if changed[0].Checksum != migrations[0].Checksum {
+		t.Error("changing a down script changed the checksum")
+	}
+	if changed[1].Checksum == migrations[1].Checksum {
+		t.Error("changing an up script did not change the checksum")
+	}
+
+	if latest := (&Migrator{migrations: migrations}).Latest(); latest != 2 {
+		t.Errorf("Latest = %d, want 2", latest)
+	}
+	if latest := (&Migrator{}).Latest(); latest != 0 {
+		t.Errorf("Latest with no migrations = %d, want 0", latest)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	migrations, err := Load(numbered(3))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	m := &Migrator{migrations: migrations}
+
+	applied := func(versions ...int) map[int]appliedMigration {
+		rows := make(map[int]appliedMigration)
+		for _, v := range versions {
+			migration := migrations[v-1]
+			rows[v] = appliedMigration{name: migration.Name, checksum: migration.Checksum}
+		}
+		return rows
+	}
+
+	edited := applied(1, 2)
+	edited[2] = appliedMigration{name: "step2", checksum: strings.Repeat("0", 64)}
+
+	unknown := applied(1, 2, 3)
+	unknown[4] = appliedMigration{name: "from_a_newer_build", checksum: strings.Repeat("0", 64)}
+
+	tests := []struct {
+		name    string
+		applied map[int]appliedMigration
+		wantErr error
+	}{
+		{"nothing applied", applied(), nil},
+		{"some applied", applied(1, 2), nil},
+		{"all applied", applied(1, 2, 3), nil},
+		{"applied migration edited", edited, ErrChecksumMismatch},
+		{"unknown version applied", unknown, ErrUnknownVersion},
+	}
+
+	for _, tt := range tests {
+		if err := m.verify(tt.applied); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: verify = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+-- Drop password reset tokens table
+DROP TABLE IF EXISTS password_reset_tokens;
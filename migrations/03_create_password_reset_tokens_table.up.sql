@@ -0,0 +1,21 @@
+-- Create password reset tokens table
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+-- Add comments to document the table
+COMMENT ON TABLE password_reset_tokens IS 'Stores single-use password reset tokens';
+COMMENT ON COLUMN password_reset_tokens.id IS 'Unique identifier for each token';
+COMMENT ON COLUMN password_reset_tokens.user_id IS 'User the token was issued for';
+COMMENT ON COLUMN password_reset_tokens.token_hash IS 'SHA-256 hash of the token sent by email';
+COMMENT ON COLUMN password_reset_tokens.expires_at IS 'Timestamp after which the token can no longer be used';
+COMMENT ON COLUMN password_reset_tokens.used_at IS 'Timestamp when the token was redeemed';
+COMMENT ON COLUMN password_reset_tokens.date_created IS 'Timestamp when the token was issued';
@@ -0,0 +1,7 @@
+-- Track email verification on users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_sent_at TIMESTAMP WITH TIME ZONE;
+
+-- Add comments to document the columns
+COMMENT ON COLUMN users.email_verified_at IS 'Timestamp when the current email address was verified';
+COMMENT ON COLUMN users.email_verification_sent_at IS 'Timestamp of the last verification email, used for throttling';
@@ -0,0 +1,45 @@
+-- Create login attempts table
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    success BOOLEAN NOT NULL,
+    attempted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, attempted_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip, attempted_at);
+
+-- Add comments to document the table
+COMMENT ON TABLE login_attempts IS 'Records login attempts for brute-force protection';
+COMMENT ON COLUMN login_attempts.id IS 'Unique identifier for each attempt';
+COMMENT ON COLUMN login_attempts.username IS 'Username that was submitted, whether or not it exists';
+COMMENT ON COLUMN login_attempts.ip IS 'Client IP address the attempt came from';
+COMMENT ON COLUMN login_attempts.success IS 'Whether the credentials were accepted';
+COMMENT ON COLUMN login_attempts.attempted_at IS 'Timestamp of the attempt';
+
+-- Create account lockouts table
+CREATE TABLE IF NOT EXISTS account_lockouts (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(10) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    failures INTEGER NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_account_lockouts_username ON account_lockouts(username, locked_until);
+CREATE INDEX IF NOT EXISTS idx_account_lockouts_ip ON account_lockouts(ip, locked_until);
+
+-- Add comments to document the table
+COMMENT ON TABLE account_lockouts IS 'Audit log of temporary lockouts caused by failed logins';
+COMMENT ON COLUMN account_lockouts.id IS 'Unique identifier for each lockout';
+COMMENT ON COLUMN account_lockouts.scope IS 'Whether the lockout applies to the account or the IP address';
+COMMENT ON COLUMN account_lockouts.username IS 'Username whose failed attempt triggered the lockout';
+COMMENT ON COLUMN account_lockouts.ip IS 'IP address whose failed attempt triggered the lockout';
+COMMENT ON COLUMN account_lockouts.failures IS 'Number of failed attempts that triggered the lockout';
+COMMENT ON COLUMN account_lockouts.locked_until IS 'Timestamp when the lockout ends';
+COMMENT ON COLUMN account_lockouts.date_created IS 'Timestamp when the lockout started';
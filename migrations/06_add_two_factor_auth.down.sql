@@ -0,0 +1,5 @@
+-- Remove two-factor authentication
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
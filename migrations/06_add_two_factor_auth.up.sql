@@ -0,0 +1,29 @@
+-- Track TOTP two-factor authentication on users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+
+-- Add comments to document the columns
+COMMENT ON COLUMN users.totp_secret IS 'Base32 TOTP secret, set during enrolment';
+COMMENT ON COLUMN users.totp_enabled_at IS 'Timestamp when two-factor authentication was confirmed';
+COMMENT ON COLUMN users.totp_last_step IS 'Last accepted TOTP time step, to prevent code reuse';
+
+-- Create recovery codes table
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_two_factor_recovery_codes_user_id ON two_factor_recovery_codes(user_id);
+
+-- Add comments to document the table
+COMMENT ON TABLE two_factor_recovery_codes IS 'Stores hashed one-time recovery codes for two-factor authentication';
+COMMENT ON COLUMN two_factor_recovery_codes.id IS 'Unique identifier for each code';
+COMMENT ON COLUMN two_factor_recovery_codes.user_id IS 'User the code belongs to';
+COMMENT ON COLUMN two_factor_recovery_codes.code_hash IS 'SHA-256 hash of the recovery code';
+COMMENT ON COLUMN two_factor_recovery_codes.used_at IS 'Timestamp when the code was redeemed';
+COMMENT ON COLUMN two_factor_recovery_codes.date_created IS 'Timestamp when the code was issued';
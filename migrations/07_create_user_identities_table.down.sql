@@ -0,0 +1,2 @@
+-- Drop user identities table
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,22 @@
+-- Create user identities table
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(100),
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- Add comments to document the table
+COMMENT ON TABLE user_identities IS 'Links external OpenID Connect identities to local users';
+COMMENT ON COLUMN user_identities.id IS 'Unique identifier for each identity';
+COMMENT ON COLUMN user_identities.user_id IS 'Local user the identity belongs to';
+COMMENT ON COLUMN user_identities.provider IS 'Configured name of the identity provider';
+COMMENT ON COLUMN user_identities.subject IS 'Subject identifier issued by the provider';
+COMMENT ON COLUMN user_identities.email IS 'Email address reported by the provider when linked';
+COMMENT ON COLUMN user_identities.date_created IS 'Timestamp when the identity was linked';
@@ -0,0 +1,29 @@
+-- Create API keys table
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+-- Add comments to document the table
+COMMENT ON TABLE api_keys IS 'Stores personal API keys for automation';
+COMMENT ON COLUMN api_keys.id IS 'Unique identifier for each key';
+COMMENT ON COLUMN api_keys.user_id IS 'User the key acts on behalf of';
+COMMENT ON COLUMN api_keys.name IS 'Name given to the key by its owner';
+COMMENT ON COLUMN api_keys.prefix IS 'Public part of the key, used to look it up';
+COMMENT ON COLUMN api_keys.key_hash IS 'SHA-256 hash of the full key';
+COMMENT ON COLUMN api_keys.scopes IS 'Permissions granted to the key, e.g. posts:read';
+COMMENT ON COLUMN api_keys.expires_at IS 'Timestamp after which the key stops working, if any';
+COMMENT ON COLUMN api_keys.last_used_at IS 'Timestamp when the key was last used';
+COMMENT ON COLUMN api_keys.revoked_at IS 'Timestamp when the key was revoked';
+COMMENT ON COLUMN api_keys.date_created IS 'Timestamp when the key was created';
@@ -0,0 +1,25 @@
+-- Create sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Add comments to document the table
+COMMENT ON TABLE sessions IS 'Stores login sessions, one per issued token';
+COMMENT ON COLUMN sessions.id IS 'Random session identifier, embedded in the token';
+COMMENT ON COLUMN sessions.user_id IS 'User the session belongs to';
+COMMENT ON COLUMN sessions.user_agent IS 'User agent of the client that logged in';
+COMMENT ON COLUMN sessions.ip IS 'IP address of the client that logged in';
+COMMENT ON COLUMN sessions.date_created IS 'Timestamp when the session was created';
+COMMENT ON COLUMN sessions.last_seen_at IS 'Timestamp of the last request made with the session';
+COMMENT ON COLUMN sessions.expires_at IS 'Timestamp when the token for the session expires';
+COMMENT ON COLUMN sessions.revoked_at IS 'Timestamp when the session was revoked';
@@ -0,0 +1,6 @@
+-- Remove profile fields from users
+ALTER TABLE users DROP COLUMN IF EXISTS profile_private;
+ALTER TABLE users DROP COLUMN IF EXISTS website;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,13 @@
+-- Add public profile fields to users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS website VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Add comments to document the columns
+COMMENT ON COLUMN users.display_name IS 'Name shown on the public profile';
+COMMENT ON COLUMN users.bio IS 'Short biography shown on the public profile';
+COMMENT ON COLUMN users.avatar_url IS 'URL of the profile picture';
+COMMENT ON COLUMN users.website IS 'Personal website linked from the public profile';
+COMMENT ON COLUMN users.profile_private IS 'Whether the profile and post list are hidden from other users';
@@ -0,0 +1,3 @@
+-- Drop follows table and the per-author posts index
+DROP INDEX IF EXISTS idx_posts_author_date;
+DROP TABLE IF EXISTS follows;
@@ -0,0 +1,22 @@
+-- Create follows table
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_follows_follower_date ON follows(follower_id, date_created DESC, followee_id DESC);
+CREATE INDEX IF NOT EXISTS idx_follows_followee_date ON follows(followee_id, date_created DESC, follower_id DESC);
+
+-- Lets the home timeline read the newest posts of each followed author
+-- straight from the index
+CREATE INDEX IF NOT EXISTS idx_posts_author_date ON posts(created_by, date_created DESC, id DESC);
+
+-- Add comments to document the table
+COMMENT ON TABLE follows IS 'Stores which users follow which authors';
+COMMENT ON COLUMN follows.follower_id IS 'User who follows';
+COMMENT ON COLUMN follows.followee_id IS 'User who is followed';
+COMMENT ON COLUMN follows.date_created IS 'Timestamp when the follow started';
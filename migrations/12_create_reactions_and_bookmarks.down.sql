@@ -0,0 +1,8 @@
+-- Drop reactions and bookmarks
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS post_reactions;
+ALTER TABLE posts DROP COLUMN IF EXISTS sad_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS wow_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS laugh_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS love_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS like_count;
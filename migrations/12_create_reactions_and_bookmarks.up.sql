@@ -0,0 +1,49 @@
+-- Add denormalised reaction counters to posts
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS like_count INTEGER NOT NULL DEFAULT 0 CHECK (like_count >= 0);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS love_count INTEGER NOT NULL DEFAULT 0 CHECK (love_count >= 0);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS laugh_count INTEGER NOT NULL DEFAULT 0 CHECK (laugh_count >= 0);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS wow_count INTEGER NOT NULL DEFAULT 0 CHECK (wow_count >= 0);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS sad_count INTEGER NOT NULL DEFAULT 0 CHECK (sad_count >= 0);
+
+-- Add comments to document the columns
+COMMENT ON COLUMN posts.like_count IS 'Number of like reactions, kept in step with post_reactions';
+COMMENT ON COLUMN posts.love_count IS 'Number of love reactions, kept in step with post_reactions';
+COMMENT ON COLUMN posts.laugh_count IS 'Number of laugh reactions, kept in step with post_reactions';
+COMMENT ON COLUMN posts.wow_count IS 'Number of wow reactions, kept in step with post_reactions';
+COMMENT ON COLUMN posts.sad_count IS 'Number of sad reactions, kept in step with post_reactions';
+
+-- Create post reactions table
+CREATE TABLE IF NOT EXISTS post_reactions (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(16) NOT NULL CHECK (reaction IN ('like', 'love', 'laugh', 'wow', 'sad')),
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, user_id)
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions(user_id);
+
+-- Add comments to document the table
+COMMENT ON TABLE post_reactions IS 'Stores the reaction of each user to a post, at most one per user';
+COMMENT ON COLUMN post_reactions.post_id IS 'Post that was reacted to';
+COMMENT ON COLUMN post_reactions.user_id IS 'User who reacted';
+COMMENT ON COLUMN post_reactions.reaction IS 'Kind of reaction';
+COMMENT ON COLUMN post_reactions.date_created IS 'Timestamp when the reaction was last set';
+
+-- Create bookmarks table
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user_date ON bookmarks(user_id, date_created DESC, post_id DESC);
+
+-- Add comments to document the table
+COMMENT ON TABLE bookmarks IS 'Stores posts users have privately saved for later';
+COMMENT ON COLUMN bookmarks.user_id IS 'User who saved the post';
+COMMENT ON COLUMN bookmarks.post_id IS 'Post that was saved';
+COMMENT ON COLUMN bookmarks.date_created IS 'Timestamp when the post was saved';
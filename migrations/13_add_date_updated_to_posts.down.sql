@@ -0,0 +1,3 @@
+-- Stop tracking when posts were last edited
+DROP INDEX IF EXISTS idx_posts_date_created_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS date_updated;
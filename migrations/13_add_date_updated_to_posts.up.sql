@@ -0,0 +1,11 @@
+-- Track when posts were last edited
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS date_updated TIMESTAMP WITH TIME ZONE;
+UPDATE posts SET date_updated = date_created WHERE date_updated IS NULL;
+ALTER TABLE posts ALTER COLUMN date_updated SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE posts ALTER COLUMN date_updated SET NOT NULL;
+
+-- Add indexes for common query patterns
+CREATE INDEX IF NOT EXISTS idx_posts_date_created_id ON posts(date_created DESC, id DESC);
+
+-- Add comments to document the columns
+COMMENT ON COLUMN posts.date_updated IS 'Timestamp when the title or content last changed';
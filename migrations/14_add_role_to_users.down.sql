@@ -0,0 +1,2 @@
+-- Remove roles from users
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,5 @@
+-- Add roles to users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+
+-- Add comments to document the columns
+COMMENT ON COLUMN users.role IS 'Either user or admin; admins can reach operational endpoints';
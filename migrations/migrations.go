@@ -0,0 +1,11 @@
+// Package migrations embeds the SQL migrations of the database schema. Each
+// version NN has an NN_name.up.sql file and an NN_name.down.sql file that
+// reverts it.
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKey represents a personal API key. The key itself is only returned once,
+// in NewAPIKeyResponse, when it is created.
+type APIKey struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	DateCreated time.Time  `json:"date_created"`
+}
+
+// NewAPIKeyRequest is used when creating an API key. ExpiresInDays of zero
+// creates a key that does not expire.
+type NewAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write profile:read"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=365"`
+}
+
+// NewAPIKeyResponse is returned after creating an API key
+type NewAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// FollowEntry is one user in a follower or following list
+type FollowEntry struct {
+	UserID int `json:"-"` // Used to build the pagination cursor
+	PublicProfile
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowListResponse is one page of a follower or following list
+type FollowListResponse struct {
+	Users      []FollowEntry `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// TimelineResponse is one page of the home timeline
+type TimelineResponse struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"next_cursor,omitempty"` // Empty on the last page
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Health statuses
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthCheck is the result of checking one dependency of the server
+type HealthCheck struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`           // HealthOK or HealthUnavailable
+	Detail     string  `json:"detail,omitempty"` // Only shown to admins
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// HealthReport is the response of the readiness endpoint
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthDetails is the admin-only health report, with what an operator
+// needs to tell why the server isn't ready
+type HealthDetails struct {
+	HealthReport
+	StartedAt       time.Time         `json:"started_at"`
+	UptimeSeconds   float64           `json:"uptime_seconds"`
+	Draining        bool              `json:"draining"`
+	SchemaVersion   int               `json:"schema_version"`
+	LatestMigration int               `json:"latest_migration"`
+	DatabasePool    DatabasePoolStats `json:"database_pool"`
+	GoVersion       string            `json:"go_version"`
+	Goroutines      int               `json:"goroutines"`
+}
+
+// DatabasePoolStats describes the database connection pool
+type DatabasePoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"` // 0 means unlimited
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitSeconds        float64 `json:"wait_seconds"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links an account at an external identity provider to a user
+type UserIdentity struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email,omitempty"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// AuthorizationURLResponse is returned when starting a flow from an API client
+type AuthorizationURLResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
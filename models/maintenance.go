@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PostsExport is the file format written by "blogctl export" and read by
+// "blogctl import"
+type PostsExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Posts      []Post    `json:"posts"` // Only the title, content, author and dates are imported
+}
+
+// IntegrityIssue is a problem found by an integrity check of the database
+type IntegrityIssue struct {
+	Check  string `json:"check"`
+	Detail string `json:"detail"`
+}
@@ -10,18 +10,60 @@ type Post struct {
 	Title       string    `json:"title"`
 	Content     string    `json:"content"`
 	DateCreated time.Time `json:"date_created"`
+	DateUpdated time.Time `json:"date_updated"`
 	CreatedBy   string    `json:"created_by"`
+
+	Reactions  map[string]int `json:"reactions"`             // Count of each kind of reaction
+	MyReaction string         `json:"my_reaction,omitempty"` // The caller's reaction, if any
+	Bookmarked bool           `json:"bookmarked,omitempty"`  // Whether the caller bookmarked the post
 }
 
-// NewPost is used when creating a post (ID and DateCreated are handled by the database)
+// NewPost is used when creating a post (ID and DateCreated are handled by the database).
+// Length limits match the posts table columns.
 type NewPost struct {
-	Title     string `json:"title"`
-	Content   string `json:"content"`
-	CreatedBy string `json:"created_by"`
+	Title     string `json:"title" validate:"required,max=255"`
+	Content   string `json:"content" validate:"required"`
+	CreatedBy string `json:"created_by" validate:"required,max=100"`
 }
 
 // UpdatePost is used when updating a post
 type UpdatePost struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Title   string `json:"title" validate:"required,max=255"`
+	Content string `json:"content" validate:"required"`
+}
+
+// PostModified is the ID and last edit time of a post, for sitemaps
+type PostModified struct {
+	ID          int
+	DateUpdated time.Time
+}
+
+// ReactionTypes lists the reactions users can give a post
+var ReactionTypes = []string{"like", "love", "laugh", "wow", "sad"}
+
+// IsReactionType reports whether reaction is one of ReactionTypes
+func IsReactionType(reaction string) bool {
+	for _, t := range ReactionTypes {
+		if t == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// ReactionRequest is used to react to a post
+type ReactionRequest struct {
+	Reaction string `json:"reaction"`
+}
+
+// Bookmark is a post in the caller's bookmarks
+type Bookmark struct {
+	Post
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+}
+
+// BookmarksResponse is one page of the caller's bookmarks
+type BookmarksResponse struct {
+	Bookmarks  []Bookmark `json:"bookmarks"`
+	NextCursor string     `json:"next_cursor,omitempty"` // Empty on the last page
 }
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PublicProfile is the view of a user shown to everyone. It never includes
+// the email address or other account details.
+type PublicProfile struct {
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	Website     string    `json:"website"`
+	DateCreated time.Time `json:"date_created"`
+
+	FollowersCount *int `json:"followers_count,omitempty"` // Only set on the profile itself
+	FollowingCount *int `json:"following_count,omitempty"`
+}
+
+// NewPublicProfile returns the public view of a user
+func NewPublicProfile(user User) PublicProfile {
+	return PublicProfile{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		Website:     user.Website,
+		DateCreated: user.DateCreated,
+	}
+}
+
+// usernamePattern limits usernames to characters that are safe in URL paths
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// reservedUsernames can't be registered because they would clash with
+// routes under /users/
+var reservedUsernames = map[string]bool{
+	"me":       true,
+	"register": true,
+	"login":    true,
+	"logout":   true,
+	"verify":   true,
+	"password": true,
+	"admin":    true,
+	"api":      true,
+}
+
+// IsReservedUsername reports whether username is reserved, ignoring case
+func IsReservedUsername(username string) bool {
+	return reservedUsernames[strings.ToLower(username)]
+}
+
+// IsValidUsername reports whether username only uses allowed characters and
+// is not reserved
+func IsValidUsername(username string) bool {
+	return usernamePattern.MatchString(username) && !IsReservedUsername(username)
+}
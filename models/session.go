@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents a logged-in device or client
+type Session struct {
+	ID          string    `json:"id"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	DateCreated time.Time `json:"date_created"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Current     bool      `json:"current"` // Whether this is the session making the request
+}
@@ -6,24 +6,47 @@ import (
 
 // User represents a user account in the system
 type User struct {
-	ID           int        `json:"id"`
-	Username     string     `json:"username"`
-	Email        string     `json:"email"`
-	PasswordHash string     `json:"-"` // Never expose password hash in JSON responses
-	DateCreated  time.Time  `json:"date_created"`
-	LastLogin    *time.Time `json:"last_login,omitempty"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"` // Never expose password hash in JSON responses
+	DateCreated     time.Time  `json:"date_created"`
+	LastLogin       *time.Time `json:"last_login,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	TOTPSecret       string `json:"-"` // Never expose the two-factor secret
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+
+	DisplayName    string `json:"display_name"`
+	Bio            string `json:"bio"`
+	AvatarURL      string `json:"avatar_url"`
+	Website        string `json:"website"`
+	ProfilePrivate bool   `json:"profile_private"`
+
+	Role string `json:"role"` // RoleUser or RoleAdmin
+}
+
+// Roles a user can have
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// IsRole reports whether role is one of the supported roles
+func IsRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
 }
 
 // NewUser is used when registering a new user
 type NewUser struct {
-	Username string `json:"username" validate:"required,min=3,max=50"`
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Username string `json:"username" validate:"required,min=3,max=50,username"`
+	Email    string `json:"email" validate:"required,max=100,email"`
+	Password string `json:"password" validate:"required"` // Strength is checked by the password policy
 }
 
 // LoginRequest is used for user login
 type LoginRequest struct {
-	Username string `json:"username" validate:"required"`
+	Username string `json:"username" validate:"required,max=255"`
 	Password string `json:"password" validate:"required"`
 }
 
@@ -33,8 +56,97 @@ type LoginResponse struct {
 	User  User   `json:"user"`
 }
 
-// TokenClaims represents the claims in a JWT token
+// TokenClaims represents the claims of an authenticated request, from either
+// a JWT token or an API key
 type TokenClaims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int      `json:"user_id"`
+	Username  string   `json:"username"`
+	SessionID string   `json:"session_id,omitempty"` // Set when authenticated with a token
+	APIKeyID  int      `json:"api_key_id,omitempty"` // Set when authenticated with an API key
+	Scopes    []string `json:"scopes,omitempty"`     // Nil for full access
+}
+
+// ForgotPasswordRequest is used to request a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,max=100,email"`
+}
+
+// ResetPasswordRequest is used to set a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// MessageResponse is returned by endpoints that have no other payload
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// UpdateUserRequest is used to update profile fields of the current user.
+// Fields left out of the request are not changed.
+type UpdateUserRequest struct {
+	Username       *string `json:"username" validate:"omitempty,min=3,max=50,username"`
+	DisplayName    *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio            *string `json:"bio" validate:"omitempty,max=500"`
+	AvatarURL      *string `json:"avatar_url" validate:"omitempty,max=255,len=0|http_url"`
+	Website        *string `json:"website" validate:"omitempty,max=255,len=0|http_url"`
+	ProfilePrivate *bool   `json:"profile_private"`
+}
+
+// ChangePasswordRequest is used to change the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// ChangeEmailRequest is used to start changing the current user's email
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,max=100,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// DeleteAccountRequest is used to confirm deletion of the current user
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// TwoFactorChallengeResponse is returned by login when a second factor is needed
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	PendingToken      string `json:"pending_token"`
+}
+
+// TwoFactorLoginRequest completes a login with a TOTP code or a recovery code
+type TwoFactorLoginRequest struct {
+	PendingToken string `json:"pending_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+// TwoFactorSetupRequest starts enrolling an authenticator. The password is
+// required so that a stolen session cannot lock the owner out.
+type TwoFactorSetupRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// TwoFactorSetupResponse is returned when a user starts enrolling an authenticator
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorConfirmRequest confirms enrolment with a code from the authenticator
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// TwoFactorConfirmResponse carries recovery codes, which are only shown once
+type TwoFactorConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// DisableTwoFactorRequest is used to turn off two-factor authentication
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
 }
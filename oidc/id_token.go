@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDTokenClaims holds the claims the relying party uses from an ID token
+type IDTokenClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// idTokenClaims is the JSON form of the ID token claims
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *Provider) verifyIDToken(ctx context.Context, md *metadata, rawIDToken string, nonce string) (IDTokenClaims, error) {
+	var claims idTokenClaims
+	token, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.Config.ClientID),
+		jwt.WithLeeway(time.Minute),
+	)
+
+	if err != nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if !token.Valid {
+		return IDTokenClaims{}, ErrInvalidIDToken
+	}
+
+	// ID tokens must always carry an expiry
+	if claims.ExpiresAt == nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: missing exp", ErrInvalidIDToken)
+	}
+
+	if claims.Subject == "" {
+		return IDTokenClaims{}, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return IDTokenClaims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return IDTokenClaims{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc discovery failed")
+	ErrExchange       = errors.New("oidc code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// ProviderConfig holds configuration for one OpenID Connect provider
+type ProviderConfig struct {
+	Name         string   // Short name used in URLs, e.g. "google"
+	IssuerURL    string   // Issuer identifier, used for discovery
+	ClientID     string   // Client ID registered with the provider
+	ClientSecret string   // Client secret registered with the provider
+	RedirectURL  string   // Callback URL registered with the provider
+	Scopes       []string // Scopes to request in addition to "openid", "email profile" if empty
+}
+
+// metadata is the subset of the discovery document that the relying party uses
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect relying party for a single provider. The
+// discovery document and signing keys are fetched lazily and cached.
+type Provider struct {
+	Config ProviderConfig
+	Client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keySet
+}
+
+// NewProvider creates a new Provider
+func NewProvider(config ProviderConfig) *Provider {
+	return &Provider{
+		Config: config,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// discover fetches and caches the provider's discovery document
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.Config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var md metadata
+	if err := p.getJSON(ctx, wellKnown, &md); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// The issuer in the document must match the configured one exactly
+	if md.Issuer != p.Config.IssuerURL {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, md.Issuer, p.Config.IssuerURL)
+	}
+
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrDiscovery)
+	}
+
+	p.metadata = &md
+	p.keys = newKeySet(md.JWKSURI, p.Client)
+	return p.metadata, nil
+}
+
+// AuthCodeURL returns the URL to send the user to for the authorization code
+// flow with PKCE
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := append([]string{"openid"}, p.Config.Scopes...)
+	if len(p.Config.Scopes) == 0 {
+		scopes = append(scopes, "email", "profile")
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.Config.ClientID)
+	params.Set("redirect_uri", p.Config.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallengeS256(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return md.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// tokenResponse is the response from the token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (IDTokenClaims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: decoding response: %v", ErrExchange, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return IDTokenClaims{}, fmt.Errorf("%w: %s %s", ErrExchange, token.Error, token.Description)
+	}
+
+	if token.IDToken == "" {
+		return IDTokenClaims{}, fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+
+	return p.verifyIDToken(ctx, md, token.IDToken, nonce)
+}
+
+// getJSON fetches a URL and decodes the JSON response
+func (p *Provider) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	return getJSON(ctx, p.Client, rawURL, v)
+}
+
+// getJSON fetches a URL with client and decodes the JSON response
+func getJSON(ctx context.Context, client *http.Client, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", rawURL, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,124 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"blog2/oidc"
+	"blog2/oidc/oidctest"
+)
+
+const redirectURL = "https://blog.example.com/auth/oidc/mock/callback"
+
+// authorize follows the mock provider's authorization endpoint and returns
+// the code and state it redirects back with
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorizing: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing redirect: %v", err)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	server := oidctest.NewServer("client", "secret", oidctest.User{Subject: "123", Email: "john@example.com", EmailVerified: true})
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		codeVerifier string
+		nonce        string
+		wantErr      error
+	}{
+		{"valid", "verifier", "nonce", nil},
+		{"wrong code verifier", "other-verifier", "nonce", oidc.ErrExchange},
+		{"wrong nonce", "verifier", "other-nonce", oidc.ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := oidc.NewProvider(oidc.ProviderConfig{
+				Name:         "mock",
+				IssuerURL:    server.Issuer(),
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RedirectURL:  redirectURL,
+			})
+			ctx := context.Background()
+
+			authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+			if err != nil {
+				t.Fatalf("AuthCodeURL: %v", err)
+			}
+
+			code, state := authorize(t, authURL)
+			if state != "state" {
+				t.Errorf("state = %q, want %q", state, "state")
+			}
+
+			identity, err := provider.Exchange(ctx, code, tt.codeVerifier, tt.nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exchange = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (identity.Subject != "123" || identity.Email != "john@example.com" || !identity.EmailVerified) {
+				t.Errorf("identity = %+v, want the mock provider's user", identity)
+			}
+		})
+	}
+}
+
+func TestAuthCodeURLPKCE(t *testing.T) {
+	server := oidctest.NewServer("client", "secret", oidctest.User{Subject: "123"})
+	defer server.Close()
+
+	provider := oidc.NewProvider(oidc.ProviderConfig{Name: "mock", IssuerURL: server.Issuer(), ClientID: "client", RedirectURL: redirectURL})
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", got)
+	}
+	if got, want := query.Get("code_challenge"), oidc.CodeChallengeS256("verifier"); got != want {
+		t.Errorf("code_challenge = %q, want %q", got, want)
+	}
+	if query.Get("code_verifier") != "" {
+		t.Error("authorization URL leaks the code verifier")
+	}
+}
+
+func TestCodeChallengeS256(t *testing.T) {
+	// RFC 7636, Appendix B
+	got := oidc.CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallengeS256 = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// prefixLength is the number of hex characters of a SHA-1 hash used to look
+// up a range, as in the Have I Been Pwned range API
+const prefixLength = 5
+
+var (
+	ErrCorpusNotSorted = errors.New("breached password corpus is not sorted by hash")
+	ErrInvalidCorpus   = errors.New("invalid breached password corpus line")
+)
+
+// Corpus returns the breached hashes sharing a SHA-1 hash prefix. Callers
+// only ever reveal the prefix, never the full hash.
+type Corpus interface {
+	// Range returns the remaining hash suffixes (uppercase hex) mapped to how
+	// often each was seen in breaches
+	Range(prefix string) (map[string]int, error)
+}
+
+// Breached rejects passwords whose SHA-1 hash appears in a corpus
+type Breached struct {
+	Corpus Corpus
+}
+
+// Check implements Rule
+func (b Breached) Check(c Candidate) (*Violation, error) {
+	sum := sha1.Sum([]byte(c.Password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := b.Corpus.Range(hash[:prefixLength])
+	if err != nil {
+		return nil, err
+	}
+
+	if suffixes[hash[prefixLength:]] == 0 {
+		return nil, nil
+	}
+
+	return &Violation{
+		Rule:    "breached",
+		Message: "Password has appeared in a data breach and cannot be used",
+	}, nil
+}
+
+// FileCorpus reads ranges from a local file of "HASH:COUNT" lines sorted by
+// hash, the format of the downloadable Have I Been Pwned SHA-1 list. Counts
+// are optional, and CRLF line endings and blank lines are accepted. An
+// index of where each prefix starts is built when the file is opened, so a
+// lookup only reads the lines for one prefix.
+type FileCorpus struct {
+	file    *os.File
+	offsets []int64 // offsets[p] is where the first hash with prefix >= p starts
+}
+
+// OpenFileCorpus opens and indexes a corpus file
+func OpenFileCorpus(path string) (*FileCorpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := indexCorpus(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &FileCorpus{file: file, offsets: offsets}, nil
+}
+
+// indexCorpus records the offset of the first line of every prefix
+func indexCorpus(r io.Reader) ([]int64, error) {
+	offsets := make([]int64, 1<<(4*prefixLength)+1)
+	next := 0 // Next prefix whose start offset is unknown
+
+	reader := bufio.NewReader(r)
+	var offset int64
+	for {
+		line, err := reader.ReadString('\n')
+		if text := strings.TrimSpace(line); text != "" { // Blank lines are skipped
+			hash, _, _ := strings.Cut(text, ":")
+			if _, hexErr := hex.DecodeString(hash); hexErr != nil || len(hash) != 2*sha1.Size {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidCorpus, text)
+			}
+
+			prefix, _ := strconv.ParseUint(hash[:prefixLength], 16, 32)
+			if int(prefix) < next-1 {
+				return nil, ErrCorpusNotSorted
+			}
+
+			// Every prefix up to this one starts here
+			for ; next <= int(prefix); next++ {
+				offsets[next] = offset
+			}
+		}
+		offset += int64(len(line))
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Prefixes past the last line, and the end sentinel, start at EOF
+	for ; next < len(offsets); next++ {
+		offsets[next] = offset
+	}
+
+	return offsets, nil
+}
+
+// Range implements Corpus
+func (f *FileCorpus) Range(prefix string) (map[string]int, error) {
+	p, err := strconv.ParseUint(prefix, 16, 32)
+	if err != nil || len(prefix) != prefixLength {
+		return nil, fmt.Errorf("invalid hash prefix %q", prefix)
+	}
+
+	start, end := f.offsets[p], f.offsets[p+1]
+	buf := make([]byte, end-start)
+
+	_, err = f.file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	suffixes := make(map[string]int)
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		hash, count, _ := strings.Cut(string(line), ":")
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			n = 1 // Plain hash lists carry no count
+		}
+		suffixes[strings.ToUpper(hash[prefixLength:])] = n
+	}
+
+	return suffixes, nil
+}
+
+// Close closes the corpus file
+func (f *FileCorpus) Close() error {
+	return f.file.Close()
+}
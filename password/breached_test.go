@@ -0,0 +1,183 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sha1Hex returns the uppercase hex SHA-1 hash of password
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// hashWith returns a 40 character hash made of prefix followed by fill
+func hashWith(prefix string, fill string) string {
+	return prefix + strings.Repeat(fill, 2*sha1.Size-len(prefix))
+}
+
+// writeCorpusFile writes a corpus file and returns its path
+func writeCorpusFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeCorpus writes a corpus file and returns it opened
+func writeCorpus(t *testing.T, contents string) *FileCorpus {
+	t.Helper()
+
+	corpus, err := OpenFileCorpus(writeCorpusFile(t, contents))
+	if err != nil {
+		t.Fatalf("OpenFileCorpus: %v", err)
+	}
+	t.Cleanup(func() { corpus.Close() })
+	return corpus
+}
+
+func TestIndexCorpus(t *testing.T) {
+	tests := []struct {
+		name    string
+		corpus  string
+		wantErr error
+	}{
+		{"empty", "", nil},
+		{"sorted", hashWith("00000", "1") + ":1\n" + hashWith("12345", "0") + ":2\n" + hashWith("FFFFF", "F") + ":3\n", nil},
+		{"no trailing newline", hashWith("00000", "1") + ":1\n" + hashWith("12345", "0") + ":2", nil},
+		{"CRLF", hashWith("00000", "1") + ":1\r\n" + hashWith("12345", "0") + ":2\r\n", nil},
+		{"blank lines", "\n" + hashWith("00000", "1") + ":1\n\r\n\n" + hashWith("12345", "0") + ":2\n\n", nil},
+		{"no counts", hashWith("00000", "1") + "\n" + hashWith("12345", "0") + "\n", nil},
+		{"lowercase", strings.ToLower(hashWith("ABCDE", "F")) + ":1\n", nil},
+		{"same prefix out of order", hashWith("12345", "F") + ":1\n" + hashWith("12345", "0") + ":2\n", nil},
+		{"prefixes out of order", hashWith("12345", "0") + ":1\n" + hashWith("00000", "1") + ":2\n", ErrCorpusNotSorted},
+		{"prefix repeated after a later one", hashWith("00000", "1") + ":1\n" + hashWith("12345", "0") + ":2\n" + hashWith("00000", "2") + ":3\n", ErrCorpusNotSorted},
+		{"not hex", hashWith("0000G", "1") + ":1\n", ErrInvalidCorpus},
+		{"short hash", "00000ABC:1\n", ErrInvalidCorpus},
+		{"short line", "000\n", ErrInvalidCorpus},
+		{"long hash", hashWith("00000", "1") + "1:1\n", ErrInvalidCorpus},
+		{"count only", ":5\n", ErrInvalidCorpus},
+		{"malformed line after valid ones", hashWith("00000", "1") + ":1\nnot a hash\n", ErrInvalidCorpus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := indexCorpus(strings.NewReader(tt.corpus))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("indexCorpus = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileCorpusRange(t *testing.T) {
+	corpus := writeCorpus(t, strings.Join([]string{
+		hashWith("00000", "0") + ":3",
+		hashWith("00000", "1"), // No count
+		"",
+		hashWith("5BAA6", "A") + ":7\r",
+		strings.ToLower(hashWith("5BAA6", "B")) + ":2\r",
+		hashWith("5BAA7", "0") + ":1",
+		hashWith("FFFFF", "E") + ":4",
+		hashWith("FFFFF", "F") + ":5", // Last line, no trailing newline
+	}, "\n"))
+
+	suffix := func(fill string) string { return strings.Repeat(fill, 2*sha1.Size-prefixLength) }
+
+	tests := []struct {
+		prefix string
+		want   map[string]int
+	}{
+		{"00000", map[string]int{suffix("0"): 3, suffix("1"): 1}},
+		{"00001", map[string]int{}},
+		{"5BAA6", map[string]int{suffix("A"): 7, suffix("B"): 2}},
+		{"5baa6", map[string]int{suffix("A"): 7, suffix("B"): 2}},
+		{"5BAA7", map[string]int{suffix("0"): 1}},
+		{"5BAA8", map[string]int{}},
+		{"12345", map[string]int{}},
+		{"FFFFE", map[string]int{}},
+		{"FFFFF", map[string]int{suffix("E"): 4, suffix("F"): 5}},
+	}
+
+	for _, tt := range tests {
+		got, err := corpus.Range(tt.prefix)
+		if err != nil {
+			t.Errorf("Range(%q): %v", tt.prefix, err)
+			continue
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("Range(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+
+	for _, prefix := range []string{"", "0000", "000000", "GGGGG", "-0001"} {
+		if _, err := corpus.Range(prefix); err == nil {
+			t.Errorf("Range(%q) accepted an invalid prefix", prefix)
+		}
+	}
+}
+
+func TestOpenFileCorpusErrors(t *testing.T) {
+	if _, err := OpenFileCorpus(filepath.Join(t.TempDir(), "missing.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenFileCorpus with a missing file = %v, want %v", err, os.ErrNotExist)
+	}
+
+	path := writeCorpusFile(t, hashWith("12345", "0")+"\n"+hashWith("00000", "0")+"\n")
+	if _, err := OpenFileCorpus(path); !errors.Is(err, ErrCorpusNotSorted) {
+		t.Errorf("OpenFileCorpus with an unsorted file = %v, want %v", err, ErrCorpusNotSorted)
+	}
+}
+
+// failingCorpus is a Corpus whose lookups fail
+type failingCorpus struct{ err error }
+
+func (f failingCorpus) Range(string) (map[string]int, error) { return nil, f.err }
+
+func TestBreached(t *testing.T) {
+	breached := sha1Hex("password")
+	corpus := writeCorpus(t, strings.Join([]string{
+		hashWith("00000", "0") + ":1",
+		breached[:prefixLength] + strings.Repeat("0", len(breached)-prefixLength) + ":5", // Same prefix, other hash
+		breached + ":9545824",
+		hashWith("FFFFF", "F") + ":1",
+	}, "\r\n"))
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"breached", "password", true},
+		{"not breached", "correct horse battery staple", false},
+		{"different case", "Password", false},
+		{"empty", "", false},
+	}
+
+	rule := Breached{Corpus: corpus}
+	for _, tt := range tests {
+		violation, err := rule.Check(Candidate{Password: tt.password})
+		if err != nil {
+			t.Fatalf("%s: Check: %v", tt.name, err)
+		}
+		if (violation != nil) != tt.want {
+			t.Errorf("%s: violation = %v, want one: %v", tt.name, violation, tt.want)
+		}
+		if violation != nil && violation.Rule != "breached" {
+			t.Errorf("%s: rule = %q, want %q", tt.name, violation.Rule, "breached")
+		}
+	}
+
+	lookupErr := errors.New("lookup failed")
+	if _, err := (Breached{Corpus: failingCorpus{lookupErr}}).Check(Candidate{Password: "password"}); !errors.Is(err, lookupErr) {
+		t.Errorf("Check with a failing corpus = %v, want %v", err, lookupErr)
+	}
+}
@@ -0,0 +1,222 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm names a password hashing algorithm
+type Algorithm string
+
+// Supported hashing algorithms
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+)
+
+var (
+	ErrUnsupportedHash = errors.New("unsupported password hash format")
+	ErrMalformedHash   = errors.New("malformed password hash")
+)
+
+// Argon2Params holds the cost parameters for Argon2id
+type Argon2Params struct {
+	Memory      uint32 // Memory in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// HashConfig selects the algorithm and parameters used for new hashes
+type HashConfig struct {
+	Algorithm  Algorithm
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultHashConfig returns the default hashing settings, Argon2id with the
+// parameters recommended by OWASP
+func DefaultHashConfig() HashConfig {
+	return HashConfig{
+		Algorithm:  Argon2id,
+		BcryptCost: 12,
+		Argon2: Argon2Params{
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+}
+
+// Hasher hashes passwords with the configured algorithm and verifies hashes
+// made with any supported algorithm. The algorithm and its parameters are
+// encoded in every hash, so they can be changed without invalidating
+// existing passwords.
+type Hasher struct {
+	config HashConfig
+}
+
+// NewHasher creates a Hasher, checking that config is usable
+func NewHasher(config HashConfig) (*Hasher, error) {
+	switch config.Algorithm {
+	case Bcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		p := config.Argon2
+		if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 || p.SaltLength == 0 || p.KeyLength == 0 {
+			return nil, errors.New("argon2id parameters must all be greater than zero")
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", config.Algorithm)
+	}
+
+	return &Hasher{config: config}, nil
+}
+
+// Hash hashes a password with the configured algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.config.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+		return string(hash), err
+	}
+
+	p := h.config.Argon2
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return encodeArgon2(p, salt, key), nil
+}
+
+// Verify reports whether password matches an encoded hash. It returns
+// ErrUnsupportedHash for hashes no supported algorithm produced, such as
+// the placeholder stored for accounts without a password.
+func (h *Hasher) Verify(encoded string, password string) (bool, error) {
+	switch {
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
+
+// NeedsRehash reports whether an encoded hash was made with a different
+// algorithm or different parameters than the configured ones
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	switch h.config.Algorithm {
+	case Bcrypt:
+		if !isBcrypt(encoded) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.config.BcryptCost
+	default:
+		p, _, _, err := decodeArgon2(encoded)
+		return err != nil || p != h.config.Argon2
+	}
+}
+
+// isBcrypt reports whether encoded looks like a bcrypt hash
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// encodeArgon2 formats an Argon2id hash in the PHC string format
+func encodeArgon2(p Argon2Params, salt []byte, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// decodeArgon2 parses an Argon2id hash in the PHC string format
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	p, err := decodeArgon2Params(parts[3])
+	if err != nil {
+		return Argon2Params{}, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
+
+// decodeArgon2Params parses the "m=...,t=...,p=..." field of an Argon2id
+// hash. Zero values are rejected, since argon2 panics on them.
+func decodeArgon2Params(field string) (Argon2Params, error) {
+	values := strings.Split(field, ",")
+	if len(values) != 3 {
+		return Argon2Params{}, ErrMalformedHash
+	}
+
+	var parsed [3]uint64
+	for i, name := range []string{"m=", "t=", "p="} {
+		value, ok := strings.CutPrefix(values[i], name)
+		if !ok {
+			return Argon2Params{}, ErrMalformedHash
+		}
+
+		bits := 32
+		if name == "p=" {
+			bits = 8
+		}
+
+		n, err := strconv.ParseUint(value, 10, bits)
+		if err != nil || n == 0 {
+			return Argon2Params{}, ErrMalformedHash
+		}
+		parsed[i] = n
+	}
+
+	return Argon2Params{
+		Memory:      uint32(parsed[0]),
+		Iterations:  uint32(parsed[1]),
+		Parallelism: uint8(parsed[2]),
+	}, nil
+}
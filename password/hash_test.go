@@ -0,0 +1,170 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testArgon2 keeps Argon2id cheap enough for tests
+var testArgon2 = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T, algorithm Algorithm) *Hasher {
+	t.Helper()
+
+	h, err := NewHasher(HashConfig{Algorithm: algorithm, BcryptCost: 4, Argon2: testArgon2})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return h
+}
+
+func TestHashRoundTrip(t *testing.T) {
+	tests := []struct {
+		algorithm Algorithm
+		prefix    string
+	}{
+		{Bcrypt, "$2a$04$"},
+		{Argon2id, "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			h := newTestHasher(t, tt.algorithm)
+
+			hash, err := h.Hash("correct horse battery")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("hash %q does not start with %q", hash, tt.prefix)
+			}
+
+			other, err := h.Hash("correct horse battery")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if other == hash {
+				t.Error("hashing the same password twice gave the same hash; salt is not random")
+			}
+
+			if ok, err := h.Verify(hash, "correct horse battery"); !ok || err != nil {
+				t.Errorf("Verify with the right password = %v, %v; want true, nil", ok, err)
+			}
+			if ok, err := h.Verify(hash, "wrong password"); ok || err != nil {
+				t.Errorf("Verify with a wrong password = %v, %v; want false, nil", ok, err)
+			}
+			if h.NeedsRehash(hash) {
+				t.Error("NeedsRehash is true for a hash made with the current settings")
+			}
+		})
+	}
+}
+
+func TestVerifyAcrossAlgorithms(t *testing.T) {
+	bcryptHash, err := newTestHasher(t, Bcrypt).Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := newTestHasher(t, Argon2id).Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Either hasher verifies hashes made by the other
+	for _, algorithm := range []Algorithm{Bcrypt, Argon2id} {
+		h := newTestHasher(t, algorithm)
+		for _, hash := range []string{bcryptHash, argonHash} {
+			if ok, err := h.Verify(hash, "correct horse battery"); !ok || err != nil {
+				t.Errorf("%s hasher: Verify(%.12s...) = %v, %v; want true, nil", algorithm, hash, ok, err)
+			}
+		}
+	}
+}
+
+func TestVerifyMalformedHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr error
+	}{
+		{"empty", "", ErrUnsupportedHash},
+		{"placeholder", "!", ErrUnsupportedHash},
+		{"argon2i", "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrUnsupportedHash},
+		{"missing key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA", ErrMalformedHash},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$", ErrMalformedHash},
+		{"empty salt", "$argon2id$v=19$m=64,t=1,p=1$$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"extra field", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5$a2V5", ErrMalformedHash},
+		{"wrong version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"missing version", "$argon2id$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"bad parameters", "$argon2id$v=19$m=64,t=x,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"trailing parameters", "$argon2id$v=19$m=64,t=1,p=1,x=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"negative memory", "$argon2id$v=19$m=-64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"zero parallelism", "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"bad salt encoding", "$argon2id$v=19$m=64,t=1,p=1$c2Fsd!$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"bad key encoding", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5=", ErrMalformedHash},
+		{"truncated bcrypt", "$2a$04$abc", nil},
+	}
+
+	h := newTestHasher(t, Argon2id)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := h.Verify(tt.encoded, "correct horse battery")
+			if ok {
+				t.Error("Verify accepted a malformed hash")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				t.Error("Verify returned no error for a malformed hash")
+			}
+			if !h.NeedsRehash(tt.encoded) {
+				t.Error("NeedsRehash is false for a malformed hash")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weakArgon := testArgon2
+	weakArgon.Iterations = 2 // Anything different from the current settings
+
+	oldArgon, err := (&Hasher{config: HashConfig{Algorithm: Argon2id, Argon2: weakArgon}}).Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldBcrypt, err := (&Hasher{config: HashConfig{Algorithm: Bcrypt, BcryptCost: 5}}).Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentArgon, err := newTestHasher(t, Argon2id).Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentBcrypt, err := newTestHasher(t, Bcrypt).Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm Algorithm
+		encoded   string
+		want      bool
+	}{
+		{"argon2id with current parameters", Argon2id, currentArgon, false},
+		{"argon2id with old parameters", Argon2id, oldArgon, true},
+		{"bcrypt when argon2id is configured", Argon2id, currentBcrypt, true},
+		{"bcrypt with current cost", Bcrypt, currentBcrypt, false},
+		{"bcrypt with old cost", Bcrypt, oldBcrypt, true},
+		{"argon2id when bcrypt is configured", Bcrypt, currentArgon, true},
+	}
+
+	for _, tt := range tests {
+		if got := newTestHasher(t, tt.algorithm).NeedsRehash(tt.encoded); got != tt.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
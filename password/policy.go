@@ -0,0 +1,85 @@
+package password
+
+import (
+	"fmt"
+)
+
+// Candidate is a password being checked together with the account it is for
+type Candidate struct {
+	Password string
+	Username string
+	Email    string
+}
+
+// Violation describes one rule a password failed
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Rule is a single password requirement. Check returns nil if the
+// candidate satisfies the rule.
+type Rule interface {
+	Check(c Candidate) (*Violation, error)
+}
+
+// Policy is an ordered set of rules a password must satisfy
+type Policy struct {
+	Rules []Rule
+}
+
+// PolicyConfig holds the settings used to build a Policy
+type PolicyConfig struct {
+	MinLength           int    // Minimum number of characters
+	MaxLength           int    // Maximum number of bytes; bcrypt ignores anything past 72
+	MinCharacterClasses int    // Minimum number of lower, upper, digit and symbol classes
+	BreachCorpusPath    string // Sorted SHA-1 hash file of breached passwords; empty to disable
+}
+
+// DefaultPolicyConfig returns the default password policy settings
+func DefaultPolicyConfig() PolicyConfig {
+	return PolicyConfig{
+		MinLength:           8,
+		MaxLength:           72,
+		MinCharacterClasses: 2,
+	}
+}
+
+// NewPolicy builds a policy from config, opening the breach corpus if one
+// is configured
+func NewPolicy(config PolicyConfig) (*Policy, error) {
+	policy := &Policy{
+		Rules: []Rule{
+			MinLength(config.MinLength),
+			MaxLength(config.MaxLength),
+			CharacterClasses(config.MinCharacterClasses),
+			NoPersonalInfo{},
+		},
+	}
+
+	if config.BreachCorpusPath != "" {
+		corpus, err := OpenFileCorpus(config.BreachCorpusPath)
+		if err != nil {
+			return nil, fmt.Errorf("opening breached password corpus: %w", err)
+		}
+		policy.Rules = append(policy.Rules, Breached{Corpus: corpus})
+	}
+
+	return policy, nil
+}
+
+// Validate checks c against every rule and returns all violations
+func (p *Policy) Validate(c Candidate) ([]Violation, error) {
+	var violations []Violation
+	for _, rule := range p.Rules {
+		violation, err := rule.Check(c)
+		if err != nil {
+			return nil, err
+		}
+		if violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+
+	return violations, nil
+}
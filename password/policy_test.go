@@ -0,0 +1,53 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	config := DefaultPolicyConfig()
+	config.BreachCorpusPath = writeCorpusFile(t, sha1Hex("johndoe")+":12\n")
+
+	policy, err := NewPolicy(config)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		candidate Candidate
+		want      []string
+	}{
+		{"valid", Candidate{Password: "correct horse battery", Username: "johndoe"}, nil},
+		{"every violation in order", Candidate{Password: "johndoe", Username: "johndoe"}, []string{"min_length", "character_classes", "personal_info", "breached"}},
+		{"too long", Candidate{Password: strings.Repeat("aB", 40), Username: "johndoe"}, []string{"max_length"}},
+	}
+
+	for _, tt := range tests {
+		violations, err := policy.Validate(tt.candidate)
+		if err != nil {
+			t.Fatalf("%s: Validate: %v", tt.name, err)
+		}
+
+		var got []string
+		for _, v := range violations {
+			got = append(got, v.Rule)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: violations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewPolicyMissingCorpus(t *testing.T) {
+	config := DefaultPolicyConfig()
+	config.BreachCorpusPath = filepath.Join(t.TempDir(), "missing.txt")
+
+	if _, err := NewPolicy(config); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("NewPolicy with a missing corpus = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,103 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MinLength requires at least the given number of characters
+type MinLength int
+
+// Check implements Rule
+func (n MinLength) Check(c Candidate) (*Violation, error) {
+	if utf8.RuneCountInString(c.Password) >= int(n) {
+		return nil, nil
+	}
+
+	return &Violation{
+		Rule:    "min_length",
+		Message: fmt.Sprintf("Password must be at least %d characters long", n),
+	}, nil
+}
+
+// MaxLength allows at most the given number of bytes. Zero disables it.
+type MaxLength int
+
+// Check implements Rule
+func (n MaxLength) Check(c Candidate) (*Violation, error) {
+	if n <= 0 || len(c.Password) <= int(n) {
+		return nil, nil
+	}
+
+	return &Violation{
+		Rule:    "max_length",
+		Message: fmt.Sprintf("Password must be at most %d bytes long", n),
+	}, nil
+}
+
+// CharacterClasses requires characters from at least the given number of
+// classes: lowercase letters, uppercase letters, digits and symbols
+type CharacterClasses int
+
+// Check implements Rule
+func (n CharacterClasses) Check(c Candidate) (*Violation, error) {
+	var lower, upper, digit, symbol bool
+	for _, r := range c.Password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+
+	if classes >= int(n) {
+		return nil, nil
+	}
+
+	return &Violation{
+		Rule: "character_classes",
+		Message: fmt.Sprintf(
+			"Password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", n,
+		),
+	}, nil
+}
+
+// minPersonalInfoLength is the shortest username or email part that
+// NoPersonalInfo looks for, so short names don't reject most passwords
+const minPersonalInfoLength = 3
+
+// NoPersonalInfo rejects passwords containing the username or the local
+// part of the email address, ignoring case
+type NoPersonalInfo struct{}
+
+// Check implements Rule
+func (NoPersonalInfo) Check(c Candidate) (*Violation, error) {
+	password := strings.ToLower(c.Password)
+
+	localPart, _, _ := strings.Cut(c.Email, "@")
+	for _, info := range []string{c.Username, localPart} {
+		info = strings.ToLower(info)
+		if len(info) >= minPersonalInfoLength && strings.Contains(password, info) {
+			return &Violation{
+				Rule:    "personal_info",
+				Message: "Password must not contain your username or email address",
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
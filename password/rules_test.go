@@ -0,0 +1,65 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      Rule
+		candidate Candidate
+		wantRule  string // Empty if the candidate passes
+	}{
+		{"min length: one short", MinLength(8), Candidate{Password: "abcdefg"}, "min_length"},
+		{"min length: exact", MinLength(8), Candidate{Password: "abcdefgh"}, ""},
+		{"min length: counts characters, not bytes", MinLength(8), Candidate{Password: strings.Repeat("é", 7)}, "min_length"},
+		{"min length: multibyte exact", MinLength(8), Candidate{Password: strings.Repeat("é", 8)}, ""},
+		{"min length: empty", MinLength(1), Candidate{}, "min_length"},
+		{"min length: zero", MinLength(0), Candidate{}, ""},
+
+		{"max length: exact", MaxLength(72), Candidate{Password: strings.Repeat("a", 72)}, ""},
+		{"max length: one over", MaxLength(72), Candidate{Password: strings.Repeat("a", 73)}, "max_length"},
+		{"max length: counts bytes", MaxLength(72), Candidate{Password: strings.Repeat("é", 37)}, "max_length"},
+		{"max length: multibyte exact", MaxLength(72), Candidate{Password: strings.Repeat("é", 36)}, ""},
+		{"max length: zero disables", MaxLength(0), Candidate{Password: strings.Repeat("a", 1000)}, ""},
+
+		{"classes: one of two", CharacterClasses(2), Candidate{Password: "abcdefgh"}, "character_classes"},
+		{"classes: two of two", CharacterClasses(2), Candidate{Password: "abcdEFGH"}, ""},
+		{"classes: three of four", CharacterClasses(4), Candidate{Password: "abcD1234"}, "character_classes"},
+		{"classes: four of four", CharacterClasses(4), Candidate{Password: "abcD123!"}, ""},
+		{"classes: space is a symbol", CharacterClasses(2), Candidate{Password: "correct horse"}, ""},
+		{"classes: non-ASCII letters", CharacterClasses(2), Candidate{Password: "éÉ"}, ""},
+		{"classes: zero", CharacterClasses(0), Candidate{}, ""},
+
+		{"personal info: username", NoPersonalInfo{}, Candidate{Password: "xjohndoe1", Username: "johndoe"}, "personal_info"},
+		{"personal info: username in other case", NoPersonalInfo{}, Candidate{Password: "xJohnDoe1", Username: "johndoe"}, "personal_info"},
+		{"personal info: email local part", NoPersonalInfo{}, Candidate{Password: "john.smith!", Username: "js", Email: "john.smith@example.com"}, "personal_info"},
+		{"personal info: email domain allowed", NoPersonalInfo{}, Candidate{Password: "example.com!", Username: "js", Email: "john.smith@example.com"}, ""},
+		{"personal info: shortest checked username", NoPersonalInfo{}, Candidate{Password: "mybob123", Username: "bob"}, "personal_info"},
+		{"personal info: username too short to check", NoPersonalInfo{}, Candidate{Password: "jo12345678", Username: "jo"}, ""},
+		{"personal info: unrelated", NoPersonalInfo{}, Candidate{Password: "correct horse", Username: "johndoe", Email: "john@example.com"}, ""},
+		{"personal info: no account details", NoPersonalInfo{}, Candidate{Password: "correct horse"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violation, err := tt.rule.Check(tt.candidate)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+
+			var got string
+			if violation != nil {
+				got = violation.Rule
+				if violation.Message == "" {
+					t.Error("violation has no message")
+				}
+			}
+			if got != tt.wantRule {
+				t.Errorf("violation = %q, want %q", got, tt.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package requestid gives every request an ID that is returned in the
+// X-Request-ID header and included in error responses and logs, so that a
+// client's report can be matched to the server's records.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header is the header the request ID is returned in
+const Header = "X-Request-ID"
+
+// contextKey is the type of the context key holding the request ID
+type contextKey struct{}
+
+// maxLength is the longest request ID accepted from a client
+const maxLength = 128
+
+// Middleware stores the request's ID in the request context and sets it on
+// the response. An ID sent by the client, for example by a proxy in front
+// of the server, is kept if it is valid; otherwise a new one is made.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !Valid(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// New returns a random request ID
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether id is acceptable as a request ID: non-empty, at most
+// 128 characters, and made only of letters, digits and "-", "_", ".", ":",
+// so that it can't break log lines or headers it is copied into
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewContext returns a copy of ctx carrying a request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,69 @@
+// Package sitemap renders XML sitemaps and sitemap indexes as described by
+// the sitemaps.org protocol.
+package sitemap
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// MaxURLs is the most URLs a single sitemap may list
+const MaxURLs = 50000
+
+// namespace is the XML namespace of sitemaps and sitemap indexes
+const namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// URL is one page listed in a sitemap, or one sitemap listed in an index
+type URL struct {
+	Loc     string
+	LastMod time.Time // Left out when zero
+}
+
+type urlSet struct {
+	XMLName xml.Name   `xml:"urlset"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	URLs    []urlEntry `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name   `xml:"sitemapindex"`
+	Xmlns    string     `xml:"xmlns,attr"`
+	Sitemaps []urlEntry `xml:"sitemap"`
+}
+
+type urlEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// URLSet renders a sitemap listing urls, which must number at most MaxURLs
+func URLSet(urls []URL) ([]byte, error) {
+	return marshal(urlSet{Xmlns: namespace, URLs: entries(urls)})
+}
+
+// Index renders a sitemap index listing the given sitemaps
+func Index(sitemaps []URL) ([]byte, error) {
+	return marshal(sitemapIndex{Xmlns: namespace, Sitemaps: entries(sitemaps)})
+}
+
+// entries converts urls to their XML form
+func entries(urls []URL) []urlEntry {
+	result := make([]urlEntry, 0, len(urls))
+	for _, u := range urls {
+		entry := urlEntry{Loc: u.Loc}
+		if !u.LastMod.IsZero() {
+			entry.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// marshal renders v as an indented XML document with a declaration
+func marshal(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
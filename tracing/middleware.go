@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"net/http"
+
+	"blog2/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of HTTP requests
+var tracer = otel.Tracer("blog2/http")
+
+// Middleware starts a server span for each request, continuing the trace in
+// its traceparent header if there is one. Spans are named after the route
+// template that route returns for the request path, such as
+// "GET /posts/{id}".
+func Middleware(route func(path string) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			template := route(r.URL.Path)
+			ctx, span := tracer.Start(ctx, r.Method+" "+template,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.HTTPRoute(template),
+					semconv.URLPath(r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			rw := logging.NewResponseWriter(w)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rw.Status()))
+			if rw.Status() >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rw.Status()))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are exported over
+// OTLP to a collector, printed for development, or not recorded at all, and
+// trace context is read from and passed on in W3C traceparent headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Exporters spans can be sent to
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config holds settings for tracing
+type Config struct {
+	Exporter    string // ExporterNone, ExporterOTLP or ExporterStdout
+	Endpoint    string // OTLP/HTTP collector URL; the OTEL_EXPORTER_OTLP_* variables apply if empty
+	ServiceName string // Reported as service.name
+}
+
+// Setup installs the global tracer provider and propagator for config. The
+// returned function flushes buffered spans and must be called before the
+// program exits.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterNone:
+		// The default global provider records nothing
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if config.Endpoint != "" {
+			endpoint, err := endpointURL(config.Endpoint)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s trace exporter: %w", config.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// tracesPath is where OTLP/HTTP collectors receive spans
+const tracesPath = "/v1/traces"
+
+// endpointURL returns the URL to send spans to for a collector URL. A URL
+// without a path, such as http://localhost:4318, gets the standard traces
+// path, as the OTEL_EXPORTER_OTLP_ENDPOINT variable does.
+func endpointURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid trace endpoint: %w", err)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = tracesPath
+	}
+
+	return u.String(), nil
+}